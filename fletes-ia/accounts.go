@@ -0,0 +1,413 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+var accountNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// account is one WhatsApp number served by this process. The single
+// account of a plain setup has no name.
+type account struct {
+	name string
+	cfg  Config
+}
+
+// loadAccounts returns one config per WhatsApp account. Without
+// WHATSAPP_ACCOUNTS there is a single account that uses the variables as
+// they are. With it, every <NAME>_ variable overrides the shared one for that
+// account, e.g. VENTAS_AI_SYSTEM_PROMPT or SOPORTE_OPENAI_MODEL.
+func loadAccounts() ([]account, error) {
+	vars, fileKeys, err := configVars()
+	if err != nil {
+		return nil, err
+	}
+
+	list := strings.TrimSpace(vars["WHATSAPP_ACCOUNTS"])
+	if list == "" {
+		cfg, err := parseConfig(vars)
+		cfg.fileKeys = fileKeys
+		if err != nil {
+			return nil, err
+		}
+		return []account{{cfg: cfg}}, nil
+	}
+
+	var accounts []account
+	dbPaths := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		name := strings.ToLower(strings.TrimSpace(item))
+		if name == "" {
+			continue
+		}
+		if !accountNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("WHATSAPP_ACCOUNTS: invalid account name %q, use letters, digits and _", name)
+		}
+
+		cfg, err := parseConfig(accountVars(vars, name))
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		}
+		cfg.fileKeys = fileKeys
+
+		path := filepath.Clean(cfg.WhatsAppDBPath)
+		if other, ok := dbPaths[path]; ok {
+			if other == name {
+				return nil, fmt.Errorf("WHATSAPP_ACCOUNTS: account %s is listed twice", name)
+			}
+			return nil, fmt.Errorf("accounts %s and %s share WHATSAPP_DB_PATH %s, set %s_WHATSAPP_DB_PATH", other, name, path, strings.ToUpper(name))
+		}
+		dbPaths[path] = name
+		accounts = append(accounts, account{name: name, cfg: cfg})
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("WHATSAPP_ACCOUNTS has no account names")
+	}
+	return accounts, nil
+}
+
+// accountVars lays the variables prefixed with the account name over the
+// shared ones.
+func accountVars(vars map[string]string, name string) map[string]string {
+	prefix := strings.ToUpper(name) + "_"
+	merged := make(map[string]string, len(vars))
+	for key, value := range vars {
+		merged[key] = value
+	}
+	for key, value := range vars {
+		if rest, ok := strings.CutPrefix(key, prefix); ok && rest != "" && strings.TrimSpace(value) != "" {
+			merged[rest] = value
+		}
+	}
+	return merged
+}
+
+// accountRunner owns everything one account needs: its database, stores,
+// WhatsApp client and chat queue. Accounts only share the usage tracker and
+// metrics, so their chats never mix.
+type accountRunner struct {
+	name string
+	// cfg is the config the account started with and is never written
+	// after startup; applied is cfg plus the reloaded fields and is only
+	// touched by watchReload.
+	cfg         Config
+	applied     Config
+	bot         *Bot
+	client      *whatsmeow.Client
+	pairing     *pairingState
+	db          *sql.DB
+	transcripts *TranscriptWriter
+	web         *webSender
+}
+
+func newAccountRunner(ctx context.Context, account account, usage *UsageTracker, metrics *Metrics, logger *slog.Logger) (*accountRunner, error) {
+	cfg := account.cfg
+	waModule, dbModule := "WA", "DB"
+	if account.name != "" {
+		logger = logger.With("account", account.name)
+		waModule, dbModule = "WA/"+account.name, "DB/"+account.name
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cfg.WhatsAppDBPath), 0o755); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+	db, err := openDatabase(cfg.WhatsAppDBPath)
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	runner := &accountRunner{name: account.name, cfg: cfg, applied: cfg, db: db, pairing: &pairingState{}}
+	if err := runner.setup(ctx, usage, metrics, logger, waModule, dbModule); err != nil {
+		runner.Close()
+		return nil, err
+	}
+	return runner, nil
+}
+
+func (r *accountRunner) setup(ctx context.Context, usage *UsageTracker, metrics *Metrics, logger *slog.Logger, waModule, dbModule string) error {
+	cfg, db := r.cfg, r.db
+
+	container := sqlstore.NewWithDB(db, "sqlite", waLog.Stdout(dbModule, "ERROR", true))
+	if err := container.Upgrade(); err != nil {
+		return fmt.Errorf("init store: %w", err)
+	}
+
+	history, err := NewConversationStore(db, cfg.HistoryLimit, cfg.MaxContextTokens)
+	if err != nil {
+		return fmt.Errorf("init history: %w", err)
+	}
+
+	messageLog, err := NewMessageLog(db, cfg.MessageLog)
+	if err != nil {
+		return fmt.Errorf("init message log: %w", err)
+	}
+
+	polls, err := NewPollStore(db)
+	if err != nil {
+		return fmt.Errorf("init polls: %w", err)
+	}
+
+	freightRequests, err := NewFreightRequestStore(db)
+	if err != nil {
+		return fmt.Errorf("init freight requests: %w", err)
+	}
+
+	optOuts, err := NewOptOutStore(db)
+	if err != nil {
+		return fmt.Errorf("init opt-outs: %w", err)
+	}
+
+	contacts, err := NewContactStore(db)
+	if err != nil {
+		return fmt.Errorf("init contacts: %w", err)
+	}
+
+	chatPrompts, err := NewSystemPromptStore(db)
+	if err != nil {
+		return fmt.Errorf("init chat prompts: %w", err)
+	}
+	if seeded, err := chatPrompts.Seed(ctx, cfg.ChatPromptsFile); err != nil {
+		return fmt.Errorf("seed chat prompts: %w", err)
+	} else if seeded > 0 {
+		logger.Info("chat prompts seeded", "count", seeded)
+	}
+
+	customers, err := loadCustomerDB(cfg.CustomersPath)
+	if err != nil {
+		return fmt.Errorf("load customers: %w", err)
+	}
+	if len(customers) > 0 {
+		logger.Info("customers loaded", "count", len(customers))
+	}
+
+	followups, err := NewScheduler(db, cfg.FollowupDelay, cfg.FollowupMessage)
+	if err != nil {
+		return fmt.Errorf("init followups: %w", err)
+	}
+
+	handoff, err := NewHandoffStore(db, cfg.HandoffIdleTimeout)
+	if err != nil {
+		return fmt.Errorf("init handoff: %w", err)
+	}
+
+	deviceStore, err := container.GetFirstDevice()
+	if err != nil {
+		return fmt.Errorf("get device: %w", err)
+	}
+
+	prompt := newPromptSource(cfg.SystemPrompt, cfg.SystemPromptFile)
+	settings, err := newBotSettings(cfg, prompt, usage, logger)
+	if err != nil {
+		return fmt.Errorf("init ai provider: %w", err)
+	}
+	if cfg.StartupHealthcheck && cfg.hasOpenAIAuth() && !cfg.DryRun {
+		if err := NewOpenAIClient(cfg, prompt, usage, logger).CheckModels(ctx); err != nil {
+			return fmt.Errorf("startup healthcheck: %w", err)
+		}
+		logger.Info("startup healthcheck passed", "base_url", cfg.OpenAIBaseURL, "model", cfg.OpenAIModel)
+	}
+
+	var embeddings *EmbeddingsClient
+	if cfg.hasOpenAIAuth() && !cfg.DryRun {
+		embeddings, err = NewEmbeddingsClient(NewOpenAIClient(cfg, prompt, usage, logger), cfg.EmbeddingsModel, cfg.EmbeddingsCachePath)
+		if err != nil {
+			return fmt.Errorf("init embeddings: %w", err)
+		}
+	}
+
+	knowledge, err := loadKnowledge(cfg.KnowledgeDir, cfg.KnowledgeChunkChars, cfg.KnowledgeTopK)
+	if err != nil {
+		return fmt.Errorf("load knowledge: %w", err)
+	}
+	if knowledge != nil {
+		if cfg.KnowledgeScoring == scoringEmbeddings && embeddings != nil {
+			if err := knowledge.UseEmbeddings(ctx, embeddings); err != nil {
+				return fmt.Errorf("index knowledge: %w", err)
+			}
+		}
+		logger.Info("knowledge base loaded", "dir", cfg.KnowledgeDir, "chunks", len(knowledge.chunks), "scoring", cfg.KnowledgeScoring)
+	}
+
+	faqEntries, err := loadFAQ(cfg.FAQPath)
+	if err != nil {
+		return fmt.Errorf("load faq: %w", err)
+	}
+	var faq *FAQMatcher
+	switch {
+	case len(faqEntries) == 0:
+	case embeddings == nil:
+		logger.Warn("faq ignored, it needs OPENAI_API_KEY for embeddings", "path", cfg.FAQPath)
+	default:
+		faq, err = NewFAQMatcher(ctx, faqEntries, embeddings, cfg.FAQThreshold)
+		if err != nil {
+			return fmt.Errorf("index faq: %w", err)
+		}
+		logger.Info("faq loaded", "path", cfg.FAQPath, "entries", len(faqEntries), "threshold", cfg.FAQThreshold)
+	}
+	if embeddings != nil {
+		if err := embeddings.Save(); err != nil {
+			logger.Warn("save embeddings cache failed", "error", err)
+		}
+	}
+
+	if cfg.MaintenanceMode {
+		logger.Warn("maintenance mode enabled, automatic replies are paused")
+	}
+
+	r.transcripts, err = NewTranscriptWriter(cfg.TranscriptPath)
+	if err != nil {
+		return fmt.Errorf("init transcripts: %w", err)
+	}
+
+	r.client = whatsmeow.NewClient(deviceStore, waLog.Stdout(waModule, "INFO", true))
+	r.bot = &Bot{
+		client:              r.client,
+		usage:               usage,
+		log:                 logger,
+		history:             history,
+		summaries:           cfg.HistorySummary,
+		handoff:             handoff,
+		limiter:             NewRateLimiter(cfg.RateLimitPerMinute),
+		rateLimitNotify:     cfg.RateLimitNotify,
+		allowlist:           cfg.ContactAllowlist,
+		blocklist:           cfg.ContactBlocklist,
+		seen:                newSeenCache(cfg.DedupCacheSize, cfg.DedupTTL),
+		sent:                newSeenCache(cfg.DedupCacheSize, cfg.OutboundDedupWindow),
+		respondInGroups:     cfg.RespondInGroups,
+		groupRequireMention: cfg.GroupRequireMention,
+		quoteOriginal:       cfg.QuoteOriginal,
+		hours:               cfg.BusinessHours,
+		messageTimeout:      cfg.MessageTimeout,
+		metrics:             metrics,
+		maxMessageChars:     cfg.MaxMessageChars,
+		transcripts:         r.transcripts,
+		maxDocumentBytes:    cfg.MaxDocumentBytes,
+		media:               mediaPolicy{maxBytes: cfg.MaxMediaBytes, allowed: cfg.MediaTypes},
+		replyTypes:          cfg.ReplyTypes,
+		sendThrottle:        newSendThrottle(cfg.SendRatePerSecond),
+		admins:              cfg.Admins,
+		prompt:              prompt,
+		chatPrompts:         chatPrompts,
+		customers:           customers,
+		followups:           followups,
+		webhook:             NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret, logger),
+		reactionAck:         cfg.ReactionAck,
+		filter:              &contentFilter{maxChars: cfg.MaxInputChars, rejectLong: cfg.LongInputMode == longInputReject, keywords: cfg.BlockedKeywords},
+		longInputMessage:    cfg.LongInputMessage,
+		longInputNotice:     cfg.LongInputNotice,
+		depot:               cfg.Depot,
+		replyCache:          newReplyCache(cfg.ReplyCacheSize, cfg.ReplyCacheTTL),
+		contacts:            contacts,
+		location:            cfg.Location,
+		maintenance:         newMaintenanceMode(cfg.MaintenanceMode),
+		messageLog:          messageLog,
+		broadcasts:          newBroadcasts(),
+		broadcastDays:       cfg.BroadcastDays,
+		exportMaxBytes:      cfg.ExportMaxBytes,
+		requests:            newRequestLimiter(cfg.MaxConcurrentRequests, cfg.ConcurrencyWait),
+		polls:               polls,
+		knowledge:           knowledge,
+		faq:                 faq,
+		freightRequests:     freightRequests,
+		priceSheetPath:      cfg.PriceSheetPath,
+		priceSheetCaption:   cfg.PriceSheetCaption,
+		settings:            settings,
+		optOuts:             optOuts,
+		optOutKeywords:      cfg.OptOutKeywords,
+		optInKeywords:       cfg.OptInKeywords,
+		optOutMessage:       cfg.OptOutMessage,
+		optInMessage:        cfg.OptInMessage,
+		sender:              r.client,
+	}
+	if cfg.ReplyAPIToken != "" {
+		r.web = newWebSender(r.client, cfg.ReplyAPIToken)
+		r.bot.sender = r.web
+	}
+	return nil
+}
+
+// Start wires the event handler and background jobs and connects, pairing
+// first when the account has no session yet. Replies run on workCtx and are
+// tracked in inflight, which main waits on before shutting down.
+func (r *accountRunner) Start(ctx, workCtx context.Context, inflight *sync.WaitGroup) error {
+	bot, client, logger := r.bot, r.client, r.bot.log
+	if r.cfg.WhatsAppDisabled {
+		logger.Warn("WHATSAPP_DISABLED is set: not connecting to WhatsApp, only POST /reply and the health endpoints are served")
+		go bot.prompt.Watch(ctx, logger)
+		return nil
+	}
+	queue := newChatQueue(r.cfg.ChatQueueSize, r.cfg.Debounce, inflight, logger, func(evt *events.Message, merged []types.MessageID) {
+		bot.markSeen(evt.Info.Chat, merged)
+		bot.handleMessage(workCtx, evt)
+	})
+	var outages *outageNotices
+	if r.cfg.AdminNotifyJID != "" {
+		notify, _ := types.ParseJID(r.cfg.AdminNotifyJID)
+		outages = newOutageNotices(r.cfg.AdminNotifyCooldown, func(text string) {
+			if bot.sendText(workCtx, notify, text) {
+				logger.Info("outage notice sent", "to", notify)
+			}
+		})
+	}
+	reconnect := newReconnector(client, r.pairing, outages, logger)
+
+	client.AddEventHandler(func(evt interface{}) {
+		switch v := evt.(type) {
+		case *events.Message:
+			if ctx.Err() != nil {
+				return
+			}
+			v.Message = unwrapMessage(v.Message)
+			if bot.priorityCommand(v) {
+				inflight.Add(1)
+				go func() {
+					defer inflight.Done()
+					bot.handleMessage(workCtx, v)
+				}()
+				return
+			}
+			queue.Enqueue(v)
+		case *events.Connected, *events.Disconnected, *events.LoggedOut:
+			reconnect.HandleEvent(ctx, v)
+		}
+	})
+
+	go bot.prompt.Watch(ctx, logger)
+	go bot.followups.Run(ctx, bot, logger)
+
+	if client.Store.ID == nil {
+		if r.name != "" {
+			fmt.Printf("Pairing account %s\n", r.name)
+		}
+		if err := pairDevice(ctx, client, r.pairing, logger); err != nil {
+			return fmt.Errorf("pair device: %w", err)
+		}
+		return nil
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	return nil
+}
+
+// Close disconnects the client and releases the account's files.
+func (r *accountRunner) Close() {
+	if r.client != nil {
+		r.client.Disconnect()
+	}
+	r.transcripts.Close()
+	r.db.Close()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// Kinds of AI provider failures. Reply and ReplyWithUsage wrap what went
+// wrong so errors.Is matches one of these, while errors.As still reaches the
+// underlying *apiError.
+var (
+	errAuth        = errors.New("ai provider rejected the credentials")
+	errRateLimited = errors.New("ai provider rate limited the request")
+	errTimeout     = errors.New("ai request timed out")
+	errServer      = errors.New("ai provider failed")
+	errBadResponse = errors.New("ai provider returned an unusable response")
+)
+
+type aiError struct {
+	kind error
+	err  error
+}
+
+func (e *aiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *aiError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// badResponse marks err as a reply the provider sent but we can't use.
+func badResponse(err error) error {
+	return &aiError{kind: errBadResponse, err: err}
+}
+
+// classifyAIError tags err with its kind from the HTTP status or the
+// underlying error. Cancellations, the content filter and errors with no
+// matching kind (a 400 for a bad model name, say) are returned as they are.
+func classifyAIError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var tagged *aiError
+	if errors.As(err, &tagged) {
+		return err
+	}
+
+	var kind error
+	var apiErr *apiError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+			kind = errAuth
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			kind = errRateLimited
+		case apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusGatewayTimeout:
+			kind = errTimeout
+		case apiErr.StatusCode >= http.StatusInternalServerError:
+			kind = errServer
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		kind = errTimeout
+	}
+	if kind == nil {
+		return err
+	}
+	return &aiError{kind: kind, err: err}
+}
+
+// aiErrorKind names the kind of err for logs, or returns "" if it has none.
+func aiErrorKind(err error) string {
+	switch {
+	case errors.Is(err, errAuth):
+		return "auth"
+	case errors.Is(err, errRateLimited):
+		return "rate_limited"
+	case errors.Is(err, errTimeout):
+		return "timeout"
+	case errors.Is(err, errServer):
+		return "server"
+	case errors.Is(err, errBadResponse):
+		return "bad_response"
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 1024
+)
+
+type AnthropicClient struct {
+	apiKey      string
+	baseURL     string
+	model       string
+	httpClient  *http.Client
+	logger      *slog.Logger
+	prompt      *promptSource
+	usage       *UsageTracker
+	maxRetries  int
+	temperature float64
+	maxTokens   int
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Temperature float64            `json:"temperature"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// NewAnthropicClient falls back to anthropicMaxTokens because the messages
+// API requires max_tokens on every request.
+func NewAnthropicClient(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) *AnthropicClient {
+	maxTokens := cfg.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = anthropicMaxTokens
+	}
+	return &AnthropicClient{
+		apiKey:      cfg.AnthropicKey,
+		baseURL:     strings.TrimRight(cfg.AnthropicBaseURL, "/"),
+		model:       cfg.AnthropicModel,
+		httpClient:  &http.Client{Timeout: cfg.OpenAITimeout},
+		logger:      logger,
+		prompt:      prompt,
+		usage:       usage,
+		maxRetries:  cfg.OpenAIRetries,
+		temperature: cfg.Temperature,
+		maxTokens:   maxTokens,
+	}
+}
+
+func (c *AnthropicClient) Reply(ctx context.Context, messages []chatMessage) (string, error) {
+	content, _, err := c.ReplyWithUsage(ctx, messages)
+	return content, err
+}
+
+// ReplyWithUsage returns errors tagged with their kind, see classifyAIError.
+func (c *AnthropicClient) ReplyWithUsage(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	reply, usage, err := c.generate(ctx, messages)
+	return reply, usage, classifyAIError(err)
+}
+
+func (c *AnthropicClient) generate(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	payload := anthropicRequest{
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		System:      systemPromptFor(ctx, c.prompt),
+		Temperature: c.temperature,
+	}
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			payload.System = strings.TrimSpace(payload.System + "\n\n" + msg.Content)
+			continue
+		}
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		payload.Messages = append(payload.Messages, anthropicMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", tokenUsage{}, fmt.Errorf("marshal request: %w", err)
+	}
+
+	start := time.Now()
+	var parsed anthropicResponse
+	err = retryWithBackoff(ctx, c.maxRetries, c.logger.With("provider", providerAnthropic), func() error {
+		headers := http.Header{}
+		headers.Set("x-api-key", c.apiKey)
+		headers.Set("anthropic-version", anthropicVersion)
+		headers.Set("Content-Type", "application/json")
+
+		resp, err := postHTTP(ctx, c.httpClient, providerAnthropic, c.baseURL+"/messages", headers, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		parsed = anthropicResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+			return badResponse(fmt.Errorf("decode response: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", tokenUsage{}, err
+	}
+
+	var text strings.Builder
+	for _, block := range parsed.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	content := strings.TrimSpace(text.String())
+	if content == "" {
+		return "", tokenUsage{}, badResponse(errors.New("anthropic returned empty content"))
+	}
+
+	usage := tokenUsage{
+		PromptTokens:     parsed.Usage.InputTokens,
+		CompletionTokens: parsed.Usage.OutputTokens,
+		TotalTokens:      parsed.Usage.InputTokens + parsed.Usage.OutputTokens,
+	}
+	return content, recordCompletion(c.logger, c.usage, providerAnthropic, c.model, usage, len(payload.Messages), time.Since(start)), nil
+}
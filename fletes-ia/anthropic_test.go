@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestAnthropicClient(t *testing.T, handler http.HandlerFunc) *AnthropicClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := Config{
+		AnthropicKey:     "test-key",
+		AnthropicModel:   "claude-test",
+		AnthropicBaseURL: server.URL + "/",
+		OpenAITimeout:    5 * time.Second,
+		Temperature:      0.2,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewAnthropicClient(cfg, newPromptSource("Sos un asistente de prueba.", ""), NewUsageTracker(nil), logger)
+}
+
+func TestAnthropicReplySuccess(t *testing.T) {
+	var got anthropicRequest
+	client := newTestAnthropicClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("path = %q, want /messages", r.URL.Path)
+		}
+		if key := r.Header.Get("x-api-key"); key != "test-key" {
+			t.Errorf("x-api-key = %q", key)
+		}
+		if version := r.Header.Get("anthropic-version"); version != anthropicVersion {
+			t.Errorf("anthropic-version = %q, want %q", version, anthropicVersion)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"content": [
+				{"type": "text", "text": "  Hola, el flete "},
+				{"type": "tool_use", "id": "t1", "name": "cotizar"},
+				{"type": "text", "text": "sale $1000.  "}
+			],
+			"usage": {"input_tokens": 12, "output_tokens": 5}
+		}`)
+	})
+
+	reply, usage, err := client.ReplyWithUsage(context.Background(), []chatMessage{
+		{Role: "system", Content: "Resumen: pidio un flete a Rosario."},
+		{Role: "user", Content: "cuanto sale?"},
+		{Role: "tool", Content: "resultado de una herramienta"},
+		{Role: "assistant", Content: "A Rosario?"},
+		{Role: "user", Content: "si"},
+	})
+	if err != nil {
+		t.Fatalf("ReplyWithUsage: %v", err)
+	}
+	if reply != "Hola, el flete sale $1000." {
+		t.Errorf("reply = %q", reply)
+	}
+	if usage.PromptTokens != 12 || usage.CompletionTokens != 5 || usage.TotalTokens != 17 {
+		t.Errorf("usage = %+v, want 12 + 5 = 17", usage)
+	}
+
+	if got.Model != "claude-test" || got.MaxTokens != anthropicMaxTokens || got.Temperature != 0.2 {
+		t.Errorf("request = %+v", got)
+	}
+	if want := "Sos un asistente de prueba.\n\nResumen: pidio un flete a Rosario."; got.System != want {
+		t.Errorf("system = %q, want %q", got.System, want)
+	}
+	want := []anthropicMessage{
+		{Role: "user", Content: "cuanto sale?"},
+		{Role: "assistant", Content: "A Rosario?"},
+		{Role: "user", Content: "si"},
+	}
+	if len(got.Messages) != len(want) {
+		t.Fatalf("messages = %+v, want %+v", got.Messages, want)
+	}
+	for i := range want {
+		if got.Messages[i] != want[i] {
+			t.Errorf("message %d = %+v, want %+v", i, got.Messages[i], want[i])
+		}
+	}
+}
+
+func TestAnthropicReplyErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		kind    error
+	}{
+		{"unauthorized", statusHandler(http.StatusUnauthorized), errAuth},
+		{"rate limited", statusHandler(http.StatusTooManyRequests), errRateLimited},
+		{"server error", statusHandler(http.StatusInternalServerError), errServer},
+		{"malformed JSON", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"content": [`)
+		}, errBadResponse},
+		{"no text blocks", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"content": [{"type": "tool_use", "id": "t1"}]}`)
+		}, errBadResponse},
+		{"bad request", statusHandler(http.StatusBadRequest), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestAnthropicClient(t, tt.handler)
+			reply, err := client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "hola"}})
+			if err == nil || reply != "" {
+				t.Fatalf("reply = %q, err = %v, want an error", reply, err)
+			}
+			for _, kind := range []error{errAuth, errRateLimited, errTimeout, errServer, errBadResponse} {
+				if got, want := errors.Is(err, kind), kind == tt.kind; got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, got, want)
+				}
+			}
+		})
+	}
+}
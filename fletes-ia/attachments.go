@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+var errNoAttachment = errors.New("attachment file not found")
+
+// attachmentMessage uploads the file at path and wraps it as an image or a
+// document depending on its type. The file is read on every call so it can
+// be replaced without a restart.
+func attachmentMessage(ctx context.Context, client *whatsmeow.Client, path, caption string) (*waProto.Message, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNoAttachment
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read attachment: %w", err)
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	mimeType, _, _ = strings.Cut(mimeType, ";")
+
+	if strings.HasPrefix(mimeType, "image/") {
+		uploaded, err := client.Upload(ctx, data, whatsmeow.MediaImage)
+		if err != nil {
+			return nil, fmt.Errorf("upload image: %w", err)
+		}
+		return &waProto.Message{ImageMessage: &waProto.ImageMessage{
+			URL:           proto.String(uploaded.URL),
+			DirectPath:    proto.String(uploaded.DirectPath),
+			MediaKey:      uploaded.MediaKey,
+			Mimetype:      proto.String(mimeType),
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    proto.Uint64(uploaded.FileLength),
+			Caption:       proto.String(caption),
+		}}, nil
+	}
+
+	return documentMessage(ctx, client, data, filepath.Base(path), mimeType, caption)
+}
+
+// documentMessage uploads data and wraps it as a document named name.
+func documentMessage(ctx context.Context, client *whatsmeow.Client, data []byte, name, mimeType, caption string) (*waProto.Message, error) {
+	uploaded, err := client.Upload(ctx, data, whatsmeow.MediaDocument)
+	if err != nil {
+		return nil, fmt.Errorf("upload document: %w", err)
+	}
+	return &waProto.Message{DocumentMessage: &waProto.DocumentMessage{
+		URL:           proto.String(uploaded.URL),
+		DirectPath:    proto.String(uploaded.DirectPath),
+		MediaKey:      uploaded.MediaKey,
+		Mimetype:      proto.String(mimeType),
+		FileEncSHA256: uploaded.FileEncSHA256,
+		FileSHA256:    uploaded.FileSHA256,
+		FileLength:    proto.Uint64(uploaded.FileLength),
+		FileName:      proto.String(name),
+		Title:         proto.String(name),
+		Caption:       proto.String(caption),
+	}}, nil
+}
+
+// sendPriceSheet sends PRICE_SHEET_PATH to chat.
+func (b *Bot) sendPriceSheet(ctx context.Context, chat types.JID) error {
+	msg, err := attachmentMessage(ctx, b.client, b.priceSheetPath, b.priceSheetCaption)
+	if err != nil {
+		return err
+	}
+	if !b.sendMessage(ctx, chat, msg) {
+		return errors.New("send price sheet failed")
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewAzureClient returns an OpenAIClient for an Azure OpenAI deployment.
+// Azure takes the same request and response bodies, but routes by
+// deployment, versions the API with a query parameter and authenticates
+// with an api-key header.
+func NewAzureClient(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) *OpenAIClient {
+	c := NewOpenAIClient(cfg, prompt, usage, logger)
+	c.provider = providerAzure
+	c.baseURL = strings.TrimRight(cfg.AzureEndpoint, "/") + "/openai/deployments/" + url.PathEscape(cfg.AzureDeployment)
+	c.query = "?api-version=" + url.QueryEscape(cfg.AzureAPIVersion)
+
+	c.headers = cfg.OpenAIExtraHeaders.Clone()
+	if c.headers == nil {
+		c.headers = http.Header{}
+	}
+	c.headers.Set("api-key", cfg.AzureKey)
+
+	// The deployment decides the model; the name is kept for usage and
+	// pricing. A fallback model would need its own deployment.
+	c.model = cfg.AzureDeployment
+	c.visionModel = cfg.AzureDeployment
+	c.fallbackModel = ""
+	return c
+}
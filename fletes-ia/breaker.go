@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("ai provider unavailable: circuit breaker open")
+
+// circuitBreaker stops calling a provider that keeps failing. After threshold
+// consecutive outage errors it opens for cooldown and rejects every call;
+// then a single probe is let through and its result closes or reopens it.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, logger *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, logger: logger, now: time.Now}
+}
+
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return errCircuitOpen
+	}
+	b.probing = true
+	b.logger.Info("circuit breaker half-open, probing provider")
+	return nil
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	switch {
+	case errors.Is(err, context.Canceled):
+		// Says nothing about the provider; a cancelled probe is retried.
+	case err != nil && isOutage(err):
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = b.now().Add(b.cooldown)
+			b.logger.Warn("circuit breaker open", "consecutive_failures", b.failures, "cooldown", b.cooldown, "error", err)
+		}
+	default:
+		// Success, or an error the provider answered with: it is reachable.
+		if b.failures >= b.threshold {
+			b.logger.Info("circuit breaker closed")
+		}
+		b.failures = 0
+	}
+}
+
+// isOutage reports whether err means the provider is down or overloaded, as
+// opposed to a bad request or a cancelled message.
+func isOutage(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// breakerProvider guards an AIProvider with a circuitBreaker.
+type breakerProvider struct {
+	provider AIProvider
+	breaker  *circuitBreaker
+}
+
+func (p *breakerProvider) Reply(ctx context.Context, messages []chatMessage) (string, error) {
+	reply, _, err := p.ReplyWithUsage(ctx, messages)
+	return reply, err
+}
+
+func (p *breakerProvider) ReplyWithUsage(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	if err := p.breaker.allow(); err != nil {
+		return "", tokenUsage{}, err
+	}
+	reply, usage, err := replyWithUsage(ctx, p.provider, messages)
+	p.breaker.record(err)
+	return reply, usage, err
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC)
+	breaker := newCircuitBreaker(2, time.Minute, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	breaker.now = func() time.Time { return now }
+	ai := &fakeAI{reply: "hola", err: &apiError{StatusCode: http.StatusServiceUnavailable}}
+	provider := &breakerProvider{provider: ai, breaker: breaker}
+	reply := func() error {
+		_, err := provider.Reply(context.Background(), []chatMessage{{Role: "user", Content: "hola"}})
+		return err
+	}
+
+	// Errors the provider answered with don't count as an outage.
+	ai.err = &apiError{StatusCode: http.StatusBadRequest}
+	for i := 0; i < 3; i++ {
+		if err := reply(); errors.Is(err, errCircuitOpen) {
+			t.Fatalf("400 #%d opened the breaker", i+1)
+		}
+	}
+
+	ai.err = &apiError{StatusCode: http.StatusServiceUnavailable}
+	reply()
+	if err := reply(); errors.Is(err, errCircuitOpen) {
+		t.Fatal("breaker open before reaching the threshold's call")
+	}
+	calls := ai.calls
+	if err := reply(); !errors.Is(err, errCircuitOpen) || ai.calls != calls {
+		t.Fatalf("after 2 outages: err %v, calls %d -> %d, want open without calling", err, calls, ai.calls)
+	}
+
+	now = now.Add(59 * time.Second)
+	if err := reply(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("within the cooldown: err %v, want open", err)
+	}
+
+	// Half-open: one failed probe reopens it for a full cooldown.
+	now = now.Add(time.Second)
+	if err := reply(); errors.Is(err, errCircuitOpen) || ai.calls != calls+1 {
+		t.Fatalf("after the cooldown: err %v, want the probe let through", err)
+	}
+	now = now.Add(30 * time.Second)
+	if err := reply(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("after a failed probe: err %v, want open again", err)
+	}
+
+	// Only one probe at a time while half-open.
+	now = now.Add(time.Minute)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := breaker.allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("second call during the probe: err %v, want open", err)
+	}
+	breaker.record(context.Canceled)
+	if err := breaker.allow(); err != nil {
+		t.Fatalf("probe after a cancelled one: %v, want it retried", err)
+	}
+	breaker.record(nil)
+
+	ai.err = nil
+	for i := 0; i < 3; i++ {
+		if err := reply(); err != nil {
+			t.Fatalf("after a successful probe: call %d err %v, want closed", i+1, err)
+		}
+	}
+	ai.err = &apiError{StatusCode: http.StatusTooManyRequests}
+	if err := reply(); errors.Is(err, errCircuitOpen) {
+		t.Fatal("one outage after closing reopened it, want the count reset")
+	}
+}
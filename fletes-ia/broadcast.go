@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// broadcastConfirmWindow is how long a prepared broadcast waits for
+// /broadcast confirmar before it has to be prepared again.
+const broadcastConfirmWindow = 5 * time.Minute
+
+type pendingBroadcast struct {
+	text    string
+	chats   []string
+	expires time.Time
+}
+
+// broadcasts holds the broadcast each admin prepared and has yet to confirm.
+type broadcasts struct {
+	mu      sync.Mutex
+	pending map[string]pendingBroadcast
+	now     func() time.Time
+}
+
+func newBroadcasts() *broadcasts {
+	return &broadcasts{pending: make(map[string]pendingBroadcast), now: time.Now}
+}
+
+func (q *broadcasts) Prepare(admin, text string, chats []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[admin] = pendingBroadcast{text: text, chats: chats, expires: q.now().Add(broadcastConfirmWindow)}
+}
+
+// Take removes and returns the admin's pending broadcast, if it hasn't
+// expired.
+func (q *broadcasts) Take(admin string) (pendingBroadcast, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending, ok := q.pending[admin]
+	delete(q.pending, admin)
+	if !ok || q.now().After(pending.expires) {
+		return pendingBroadcast{}, false
+	}
+	return pending, true
+}
+
+// ActiveChats lists the one-to-one chats that wrote to the bot since the
+// given time. Groups are left out.
+func (l *MessageLog) ActiveChats(ctx context.Context, since time.Time) ([]string, error) {
+	if l == nil {
+		return nil, nil
+	}
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT DISTINCT chat_jid FROM fletes_message_log
+		WHERE direction = ? AND created_at >= ?
+		ORDER BY chat_jid`, directionIn, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("query active chats: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []string
+	for rows.Next() {
+		var chat string
+		if err := rows.Scan(&chat); err != nil {
+			return nil, fmt.Errorf("scan active chats: %w", err)
+		}
+		if jid, err := types.ParseJID(chat); err == nil && jid.Server == types.DefaultUserServer {
+			chats = append(chats, chat)
+		}
+	}
+	return chats, rows.Err()
+}
+
+// cmdBroadcast sends a message to every chat seen in the last BROADCAST_DAYS,
+// in two steps so a typo doesn't reach every customer:
+//
+//	/broadcast <texto>      prepares it and shows how many chats get it
+//	/broadcast confirmar    sends the prepared text
+//	/broadcast cancelar     drops it
+func cmdBroadcast(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return helpText
+	}
+	if b.messageLog == nil {
+		return "La difusión necesita MESSAGE_LOG=true para saber a quién enviar."
+	}
+	admin := evt.Info.Sender.ToNonAD().String()
+
+	switch strings.ToLower(args) {
+	case "":
+		return "Uso: /broadcast <texto>, después /broadcast confirmar para enviarlo."
+	case "cancelar":
+		if _, ok := b.broadcasts.Take(admin); !ok {
+			return "No hay ninguna difusión pendiente."
+		}
+		return "Difusión cancelada."
+	case "confirmar":
+		pending, ok := b.broadcasts.Take(admin)
+		if !ok {
+			return "No hay ninguna difusión pendiente o ya venció. Volvé a escribir /broadcast <texto>."
+		}
+		return b.sendBroadcast(ctx, admin, pending)
+	}
+
+	since := time.Now().AddDate(0, 0, -b.broadcastDays)
+	chats, err := b.messageLog.ActiveChats(ctx, since)
+	if err != nil {
+		b.log.Error("list broadcast chats failed", "error", err)
+		return "No pude armar la lista de chats, probá de nuevo más tarde."
+	}
+	if len(chats) == 0 {
+		return fmt.Sprintf("No hay chats con mensajes en los últimos %d días.", b.broadcastDays)
+	}
+	b.broadcasts.Prepare(admin, args, chats)
+	return fmt.Sprintf("Se va a enviar a %d chats de los últimos %d días:\n\n%s\n\nRespondé /broadcast confirmar en los próximos %d minutos para enviarlo, o /broadcast cancelar.",
+		len(chats), b.broadcastDays, args, int(broadcastConfirmWindow/time.Minute))
+}
+
+// sendBroadcast delivers a confirmed broadcast through the outbound
+// throttle, skipping chats that opted out.
+func (b *Bot) sendBroadcast(ctx context.Context, admin string, pending pendingBroadcast) string {
+	logger := b.log.With("by", admin, "chats", len(pending.chats))
+	logger.Info("broadcast started")
+
+	var sent, failed, skipped int
+	for _, chat := range pending.chats {
+		if ctx.Err() != nil {
+			break
+		}
+		if out, err := b.optOuts.Active(ctx, chat); err != nil {
+			logger.Error("check opt-out failed", "chat", chat, "error", err)
+		} else if out {
+			skipped++
+			continue
+		}
+		jid, err := types.ParseJID(chat)
+		if err != nil {
+			failed++
+			continue
+		}
+		if b.sendText(ctx, jid, pending.text) {
+			sent++
+		} else {
+			failed++
+		}
+	}
+	pendingCount := len(pending.chats) - sent - failed - skipped
+
+	logger.Info("broadcast finished", "sent", sent, "failed", failed, "opted_out", skipped, "not_attempted", pendingCount)
+	result := fmt.Sprintf("Difusión terminada: %d enviados, %d con error, %d omitidos por baja.", sent, failed, skipped)
+	if pendingCount > 0 {
+		result += fmt.Sprintf(" %d quedaron sin enviar porque el bot se detuvo.", pendingCount)
+	}
+	return result
+}
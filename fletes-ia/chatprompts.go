@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const chatPromptSchema = `
+CREATE TABLE IF NOT EXISTS fletes_chat_prompts (
+	chat_jid   TEXT    PRIMARY KEY,
+	prompt     TEXT    NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+`
+
+// SystemPromptStore keeps per-chat system prompts that replace the global
+// one, for customers that get a personalized assistant.
+type SystemPromptStore struct {
+	db *sql.DB
+}
+
+func NewSystemPromptStore(db *sql.DB) (*SystemPromptStore, error) {
+	if _, err := db.Exec(chatPromptSchema); err != nil {
+		return nil, fmt.Errorf("create chat prompt table: %w", err)
+	}
+	return &SystemPromptStore{db: db}, nil
+}
+
+// Seed loads a JSON object mapping phone numbers or JIDs to prompts. Chats
+// that already have a prompt keep it, so runtime changes made with /prompt
+// survive restarts. A missing file is not an error.
+func (s *SystemPromptStore) Seed(ctx context.Context, path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read chat prompts: %w", err)
+	}
+
+	var prompts map[string]string
+	if err := json.Unmarshal(data, &prompts); err != nil {
+		return 0, fmt.Errorf("parse chat prompts: %w", err)
+	}
+
+	seeded := 0
+	now := time.Now().Unix()
+	for contact, prompt := range prompts {
+		chat, err := normalizeContact(contact)
+		if err != nil {
+			return seeded, err
+		}
+		prompt = strings.TrimSpace(prompt)
+		if prompt == "" {
+			continue
+		}
+		res, err := s.db.ExecContext(ctx, `
+			INSERT INTO fletes_chat_prompts (chat_jid, prompt, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT (chat_jid) DO NOTHING`, chat, prompt, now)
+		if err != nil {
+			return seeded, fmt.Errorf("seed chat prompt: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			seeded++
+		}
+	}
+	return seeded, nil
+}
+
+func (s *SystemPromptStore) Get(ctx context.Context, chat string) (string, bool, error) {
+	var prompt string
+	err := s.db.QueryRowContext(ctx, `SELECT prompt FROM fletes_chat_prompts WHERE chat_jid = ?`, chat).Scan(&prompt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("query chat prompt: %w", err)
+	}
+	return prompt, true, nil
+}
+
+func (s *SystemPromptStore) Set(ctx context.Context, chat, prompt string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_chat_prompts (chat_jid, prompt, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (chat_jid) DO UPDATE SET prompt = excluded.prompt, updated_at = excluded.updated_at`,
+		chat, prompt, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("set chat prompt: %w", err)
+	}
+	return nil
+}
+
+func (s *SystemPromptStore) Delete(ctx context.Context, chat string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM fletes_chat_prompts WHERE chat_jid = ?`, chat); err != nil {
+		return fmt.Errorf("delete chat prompt: %w", err)
+	}
+	return nil
+}
+
+type systemPromptKey struct{}
+
+// withSystemPrompt makes providers use prompt instead of the global system
+// prompt for requests made with the returned context.
+func withSystemPrompt(ctx context.Context, prompt string) context.Context {
+	return context.WithValue(ctx, systemPromptKey{}, prompt)
+}
+
+// systemPromptFor returns the chat override carried by ctx, or the global
+// prompt.
+func systemPromptFor(ctx context.Context, global *promptSource) string {
+	if prompt, ok := ctx.Value(systemPromptKey{}).(string); ok && prompt != "" {
+		return prompt
+	}
+	return global.Get()
+}
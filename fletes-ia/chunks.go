@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxMessageChars = 4000
+	messageChunkDelay      = 700 * time.Millisecond
+	codeFence              = "```"
+)
+
+// splitMessage breaks text into chunks of at most maxChars runes. Cuts are
+// tried on paragraph breaks, then line breaks, sentence ends and spaces, and a
+// cut inside a ``` code block is only used when nothing else fits.
+func splitMessage(text string, maxChars int) []string {
+	text = strings.TrimSpace(text)
+	if maxChars <= 0 || len([]rune(text)) <= maxChars {
+		return []string{text}
+	}
+
+	var chunks []string
+	runes := []rune(text)
+	for len(runes) > maxChars {
+		cut := splitPoint(runes[:maxChars])
+		if chunk := strings.TrimSpace(string(runes[:cut])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " \n"))
+	}
+	if rest := strings.TrimSpace(string(runes)); rest != "" {
+		chunks = append(chunks, rest)
+	}
+	return chunks
+}
+
+func splitPoint(window []rune) int {
+	inCode := func(pos int) bool {
+		return strings.Count(string(window[:pos]), codeFence)%2 == 1
+	}
+	separators := []string{"\n\n", "\n", ". ", "! ", "? ", " "}
+	for _, allowCode := range []bool{false, true} {
+		for _, sep := range separators {
+			if cut := lastCut(window, sep, inCode, allowCode); cut > 0 {
+				return cut
+			}
+		}
+	}
+	return len(window)
+}
+
+func lastCut(window []rune, sep string, inCode func(int) bool, allowCode bool) int {
+	sepRunes := []rune(sep)
+	for i := len(window) - len(sepRunes); i > 0; i-- {
+		if string(window[i:i+len(sepRunes)]) != sep {
+			continue
+		}
+		cut := i + len(sepRunes)
+		if allowCode || !inCode(cut) {
+			return cut
+		}
+	}
+	return 0
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const helpText = `Comandos disponibles:
+/help - muestra esta ayuda
+/reset - borra el historial de la conversación
+/human - deriva la conversación a una persona del equipo
+/bot - vuelve a activar las respuestas automáticas
+/ubicacion - envía la ubicación del depósito
+/tarifas - envía la lista de precios`
+
+type commandFunc func(ctx context.Context, b *Bot, evt *events.Message, args string) string
+
+var commands = map[string]commandFunc{
+	"help":        cmdHelp,
+	"reset":       cmdReset,
+	"human":       cmdHuman,
+	"bot":         cmdBot,
+	"stats":       cmdStats,
+	"prompt":      cmdPrompt,
+	"ubicacion":   cmdLocation,
+	"tarifas":     cmdPriceSheet,
+	"maintenance": cmdMaintenance,
+	"broadcast":   cmdBroadcast,
+	"export":      cmdExport,
+}
+
+func parseCommand(text string) (name, args string, ok bool) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	name, args, _ = strings.Cut(strings.TrimPrefix(text, "/"), " ")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(args), true
+}
+
+// priorityCommand reports whether evt is a command from ADMIN_JIDS. Those
+// skip the chat queue, so /maintenance or /stats answer at once even when
+// the chat has a backlog or its queue is full.
+func (b *Bot) priorityCommand(evt *events.Message) bool {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return false
+	}
+	_, _, ok := parseCommand(extractMessageText(evt.Message, true))
+	return ok
+}
+
+func (b *Bot) dispatchCommand(ctx context.Context, evt *events.Message, text string) bool {
+	name, args, ok := parseCommand(text)
+	if !ok {
+		return false
+	}
+
+	reply := "Comando desconocido. Escribí /help para ver las opciones."
+	if handler, found := commands[name]; found {
+		reply = handler(ctx, b, evt, args)
+	}
+
+	b.log.Info("command received", "command", name, "chat", evt.Info.Chat, "message_id", evt.Info.ID)
+	if reply != "" {
+		b.sendText(ctx, evt.Info.Chat, reply)
+	}
+	return true
+}
+
+func cmdHelp(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	return helpText
+}
+
+func cmdReset(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if err := b.history.Clear(ctx, evt.Info.Chat.ToNonAD().String()); err != nil {
+		b.log.Error("clear history failed", "chat", evt.Info.Chat, "error", err)
+		return "No pude borrar el historial, probá de nuevo más tarde."
+	}
+	return "Listo, empezamos una conversación nueva."
+}
+
+func cmdHuman(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if err := b.handoff.Enable(ctx, evt.Info.Chat.ToNonAD().String()); err != nil {
+		b.log.Error("enable handoff failed", "chat", evt.Info.Chat, "error", err)
+		return "No pude derivar la conversacion, probá de nuevo en un momento."
+	}
+	return "Te derivamos con una persona del equipo. En breve te responden."
+}
+
+func cmdBot(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if err := b.handoff.Disable(ctx, evt.Info.Chat.ToNonAD().String()); err != nil {
+		b.log.Error("disable handoff failed", "chat", evt.Info.Chat, "error", err)
+		return "No pude reactivar las respuestas automáticas, probá de nuevo en un momento."
+	}
+	return "Las respuestas automáticas están activas de nuevo."
+}
+
+func cmdLocation(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if b.depot == nil {
+		return "Por ahora no tenemos la ubicación del depósito cargada. Escribinos y te pasamos la dirección."
+	}
+	if !b.sendLocation(ctx, evt.Info.Chat) {
+		return "No pude enviar la ubicación. Probá de nuevo en unos minutos, por favor."
+	}
+	return ""
+}
+
+// cmdPriceSheet sends PRICE_SHEET_PATH, or says there is none loaded.
+func cmdPriceSheet(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	err := b.sendPriceSheet(ctx, evt.Info.Chat)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, errNoAttachment) || b.priceSheetPath == "":
+		return "Por ahora no tenemos la lista de tarifas cargada. Contanos origen, destino y qué tenés que llevar y te cotizamos."
+	default:
+		b.log.Error("price sheet not sent", "chat", evt.Info.Chat, "path", b.priceSheetPath, "error", err)
+		return "No pude enviar la lista de tarifas. Probá de nuevo en unos minutos, por favor."
+	}
+}
+
+// cmdStats is limited to ADMIN_JIDS; everyone else gets the help text.
+func cmdStats(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return helpText
+	}
+
+	usage := b.usage.Totals()
+	return fmt.Sprintf(`Estado del bot:
+Activo hace: %s
+Mensajes recibidos: %d
+Respuestas enviadas: %d
+Errores de IA: %d
+Tokens usados: %d (%d prompt, %d respuesta)
+Costo estimado: US$ %.4f`,
+		b.metrics.Uptime().Round(time.Second),
+		b.metrics.messagesReceived.Load(),
+		b.metrics.repliesSent.Load(),
+		b.metrics.aiErrors.Load(),
+		usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens,
+		usage.CostUSD,
+	) + formatUnsupported(b.metrics.Unsupported())
+}
+
+// cmdMaintenance shows or switches maintenance mode: /maintenance [on|off].
+func cmdMaintenance(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return helpText
+	}
+
+	switch strings.ToLower(args) {
+	case "":
+	case "on":
+		if b.maintenance.Set(true) {
+			b.log.Warn("maintenance mode enabled", "by", evt.Info.Sender)
+		}
+	case "off":
+		if b.maintenance.Set(false) {
+			b.log.Warn("maintenance mode disabled", "by", evt.Info.Sender)
+		}
+	default:
+		return "Uso: /maintenance [on|off]"
+	}
+
+	if b.maintenance.Active() {
+		return "Modo mantenimiento activo: no se responden mensajes automaticamente."
+	}
+	return "Modo mantenimiento desactivado: el bot responde normalmente."
+}
+
+// formatUnsupported lists ignored message types, most frequent first.
+func formatUnsupported(counts map[string]int64) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	kinds := sortedKeys(counts)
+	sort.SliceStable(kinds, func(i, j int) bool { return counts[kinds[i]] > counts[kinds[j]] })
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%s %d", kind, counts[kind])
+	}
+	return "\nTipos no soportados: " + strings.Join(parts, ", ")
+}
+
+// cmdPrompt manages the per-chat system prompt. It applies to the current
+// chat unless the first argument is a phone number or JID:
+//
+//	/prompt [chat]          shows the prompt
+//	/prompt [chat] reset    goes back to the global prompt
+//	/prompt [chat] <text>   sets a new prompt
+func cmdPrompt(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return helpText
+	}
+
+	chat := evt.Info.Chat.ToNonAD().String()
+	if first, rest, _ := strings.Cut(args, " "); looksLikeContact(first) {
+		target, err := normalizeContact(first)
+		if err != nil {
+			return "No reconozco ese número o chat."
+		}
+		chat, args = target, strings.TrimSpace(rest)
+	}
+
+	switch args {
+	case "":
+		prompt, ok, err := b.chatPrompts.Get(ctx, chat)
+		if err != nil {
+			b.log.Error("load chat prompt failed", "chat", chat, "error", err)
+			return "No pude leer el prompt, probá de nuevo más tarde."
+		}
+		if !ok {
+			return "Este chat usa el prompt general."
+		}
+		return "Prompt de " + chat + ":\n" + prompt
+	case "reset":
+		if err := b.chatPrompts.Delete(ctx, chat); err != nil {
+			b.log.Error("delete chat prompt failed", "chat", chat, "error", err)
+			return "No pude borrar el prompt, probá de nuevo más tarde."
+		}
+		return "Listo, " + chat + " vuelve a usar el prompt general."
+	default:
+		if err := validatePromptTemplate("prompt", args); err != nil {
+			return "El prompt tiene un error en las variables ({{.Date}}, {{.Time}}, {{.Weekday}}, {{.BusinessHours}}, {{.DepotName}}, {{.DepotAddress}}): " + err.Error()
+		}
+		if err := b.chatPrompts.Set(ctx, chat, args); err != nil {
+			b.log.Error("set chat prompt failed", "chat", chat, "error", err)
+			return "No pude guardar el prompt, probá de nuevo más tarde."
+		}
+		return "Listo, guardé el prompt para " + chat + "."
+	}
+}
+
+func looksLikeContact(value string) bool {
+	if strings.Contains(value, "@") {
+		return true
+	}
+	digits := 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' || r == '-':
+		default:
+			return false
+		}
+	}
+	return digits >= 8
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errTooBusy = errors.New("too many AI requests in flight")
+
+// requestLimiter caps the AI requests running at once across all chats.
+// A nil limiter lets every request through.
+type requestLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newRequestLimiter(limit int, wait time.Duration) *requestLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &requestLimiter{slots: make(chan struct{}, limit), wait: wait}
+}
+
+// Acquire waits up to the configured time for a free slot. It returns
+// errTooBusy if none frees up, or ctx's error if ctx ends first.
+func (l *requestLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-timer.C:
+		return nil, errTooBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *requestLimiter) release() {
+	<-l.slots
+}
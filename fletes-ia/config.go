@@ -0,0 +1,567 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configVars reads CONFIG_FILE, if set, and lays the environment over it.
+// Empty environment variables don't hide file values, so a .env copied from
+// .env.example can be used together with a config file. fileKeys lists the
+// variables that came from the file.
+func configVars() (vars map[string]string, fileKeys map[string]bool, err error) {
+	vars = make(map[string]string)
+	if path := strings.TrimSpace(os.Getenv("CONFIG_FILE")); path != "" {
+		fileVars, err := readConfigFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("CONFIG_FILE: %w", err)
+		}
+		fileKeys = make(map[string]bool, len(fileVars))
+		for key, value := range fileVars {
+			vars[key] = value
+			fileKeys[key] = true
+		}
+	}
+	for _, entry := range os.Environ() {
+		if key, value, ok := strings.Cut(entry, "="); ok && strings.TrimSpace(value) != "" {
+			vars[key] = value
+		}
+	}
+
+	return vars, fileKeys, nil
+}
+
+// parseConfig builds a Config from vars without reading the process
+// environment. Every invalid or missing value is reported in a single error.
+func parseConfig(vars map[string]string) (Config, error) {
+	r := &configReader{vars: vars, keys: make(map[string]struct{})}
+
+	promptFile := r.value("AI_SYSTEM_PROMPT_FILE")
+	systemPrompt, err := loadSystemPrompt(promptFile, r.str("AI_SYSTEM_PROMPT", "Sos un asistente para Fletes Ostrit. Responde en espanol de forma breve y clara."))
+	r.check(err)
+
+	rates, err := loadRateTable(r.str("FREIGHT_RATES_PATH", "data/tarifas.csv"))
+	if err != nil {
+		r.check(fmt.Errorf("FREIGHT_RATES_PATH: %w", err))
+	}
+
+	logLevel, err := parseLogLevel(r.value("LOG_LEVEL"))
+	r.check(err)
+
+	logFormat := strings.ToLower(r.str("LOG_FORMAT", "text"))
+	if logFormat != "text" && logFormat != "json" {
+		r.check(errors.New("LOG_FORMAT must be text or json"))
+	}
+
+	allowlist, err := parseContactSet("CONTACT_ALLOWLIST", r.value("CONTACT_ALLOWLIST"))
+	r.check(err)
+	blocklist, err := parseContactSet("CONTACT_BLOCKLIST", r.value("CONTACT_BLOCKLIST"))
+	r.check(err)
+
+	admins, err := parseContactSet("ADMIN_JIDS", r.value("ADMIN_JIDS"))
+	r.check(err)
+	var adminNotify string
+	if value := r.value("ADMIN_NOTIFY_JID"); value != "" {
+		adminNotify, err = normalizeContact(value)
+		if err != nil {
+			r.check(fmt.Errorf("ADMIN_NOTIFY_JID: %w", err))
+		}
+	}
+
+	greetings, err := parseGreetingReplies("GREETING_REPLIES", r.value("GREETING_REPLIES"), r.positiveInt("GREETING_MAX_WORDS", defaultGreetingMaxWords))
+	r.check(err)
+
+	filters, err := parseReplyFilters("REPLY_FILTERS", r.str("REPLY_FILTERS", defaultReplyFilters), "REPLY_BANNED_PHRASES", r.value("REPLY_BANNED_PHRASES"))
+	r.check(err)
+
+	replyTypes, err := parseReplyTypes("REPLY_MESSAGE_TYPES", r.value("REPLY_MESSAGE_TYPES"))
+	r.check(err)
+
+	blockedKeywords, err := loadBlockedKeywords(r.value("BLOCKED_KEYWORDS"), r.value("BLOCKED_KEYWORDS_FILE"))
+	if err != nil {
+		r.check(fmt.Errorf("BLOCKED_KEYWORDS_FILE: %w", err))
+	}
+
+	openAIHeaders, err := parseHeaders("OPENAI_EXTRA_HEADERS", r.value("OPENAI_EXTRA_HEADERS"))
+	r.check(err)
+	openAIProxy, err := parseProxyURL("OPENAI_PROXY_URL", r.value("OPENAI_PROXY_URL"))
+	r.check(err)
+
+	pricing, err := parsePricing("OPENAI_PRICING", r.value("OPENAI_PRICING"))
+	r.check(err)
+
+	businessTZ, err := time.LoadLocation(r.str("BUSINESS_TZ", "America/Argentina/Buenos_Aires"))
+	if err != nil {
+		r.check(fmt.Errorf("BUSINESS_TZ: %w", err))
+		businessTZ = time.UTC
+	}
+	businessHours, err := parseBusinessHours(r.value("BUSINESS_HOURS"), businessTZ)
+	if err != nil {
+		r.check(fmt.Errorf("BUSINESS_HOURS: %w", err))
+	}
+	timedPrompts, err := parseTimedPrompts(r.value("AI_TIMED_PROMPTS"), r.value, businessTZ)
+	r.check(err)
+	languagePrompts, err := parseLanguagePrompts(r.value, r.boolean("MULTILINGUAL", false))
+	r.check(err)
+
+	depot, err := parseDepotLocation(r.value("DEPOT_LAT"), r.value("DEPOT_LON"), r.str("DEPOT_NAME", "Fletes Ostrit"), r.value("DEPOT_ADDRESS"))
+	r.check(err)
+
+	replyDelay, err := parseReplyDelay("ARTIFICIAL_DELAY_MS", r.value("ARTIFICIAL_DELAY_MS"),
+		time.Duration(r.nonNegativeInt("ARTIFICIAL_DELAY_PER_CHAR_MS", 0))*time.Millisecond,
+		time.Duration(r.nonNegativeInt("ARTIFICIAL_DELAY_MAX_MS", 8000))*time.Millisecond)
+	r.check(err)
+
+	cfg := Config{
+		OpenAIKey:           r.value("OPENAI_API_KEY"),
+		OpenAIModel:         r.str("OPENAI_MODEL", "gpt-4o-mini"),
+		OpenAIFallbackModel: r.value("OPENAI_FALLBACK_MODEL"),
+		OpenAIBaseURL:       r.str("OPENAI_BASE_URL", "https://api.openai.com/v1"),
+		OpenAITimeout:       r.seconds("OPENAI_TIMEOUT_SECONDS", 30*time.Second),
+		MessageTimeout:      r.seconds("MESSAGE_TIMEOUT_SECONDS", 90*time.Second),
+		OpenAIRetries:       r.nonNegativeInt("OPENAI_MAX_RETRIES", 3),
+		OpenAIStream:        r.boolean("OPENAI_STREAM", false),
+		StreamEdits:         r.boolean("STREAM_EDITS", false),
+		LengthAction:        strings.ToLower(r.str("OPENAI_LENGTH_ACTION", lengthNote)),
+		TranscribeModel:     r.str("OPENAI_TRANSCRIBE_MODEL", "whisper-1"),
+		OpenAIPricing:       pricing,
+		EnableVision:        r.boolean("ENABLE_VISION", false),
+		VisionModel:         r.str("OPENAI_VISION_MODEL", "gpt-4o-mini"),
+		VisionPrompt:        r.str("AI_VISION_PROMPT", defaultVisionPrompt),
+		SystemPrompt:        systemPrompt,
+		SystemPromptFile:    promptFile,
+		TimedPrompts:        timedPrompts,
+		ChatPromptsFile:     r.str("CHAT_PROMPTS_FILE", "data/chat_prompts.json"),
+		CustomersPath:       r.str("CUSTOMERS_CSV_PATH", "data/clientes.csv"),
+		WhatsAppDBPath:      r.str("WHATSAPP_DB_PATH", defaultWhatsAppDBPath),
+		WhatsAppDisabled:    r.boolean("WHATSAPP_DISABLED", false),
+		ShutdownTimeout:     r.seconds("SHUTDOWN_TIMEOUT_SECONDS", 15*time.Second),
+		DedupCacheSize:      r.positiveInt("DEDUP_CACHE_SIZE", 1000),
+		DedupTTL:            r.seconds("DEDUP_TTL_SECONDS", 10*time.Minute),
+		OutboundDedupWindow: r.duration("OUTBOUND_DEDUP_WINDOW", 30*time.Second),
+		HistoryLimit:        r.positiveInt("AI_HISTORY_LIMIT", 20),
+		HistorySummary: summaryPolicy{
+			threshold: r.nonNegativeInt("HISTORY_SUMMARY_THRESHOLD", 0),
+			keep:      r.positiveInt("HISTORY_SUMMARY_KEEP", 6),
+		},
+		MaxContextTokens:    r.nonNegativeInt("MAX_CONTEXT_TOKENS", 0),
+		HandoffIdleTimeout:  time.Duration(r.nonNegativeInt("HANDOFF_IDLE_MINUTES", 0)) * time.Minute,
+		RateLimitPerMinute:  r.nonNegativeInt("RATE_LIMIT_PER_MINUTE", 10),
+		RateLimitNotify:     r.boolean("RATE_LIMIT_NOTIFY", true),
+		ContactAllowlist:    allowlist,
+		ContactBlocklist:    blocklist,
+		Admins:              admins,
+		AdminNotifyJID:      adminNotify,
+		AdminNotifyCooldown: r.duration("ADMIN_NOTIFY_COOLDOWN", 10*time.Minute),
+		TypingIndicator:     r.boolean("SEND_TYPING_INDICATOR", true),
+		MarkRead:            r.boolean("MARK_READ", true),
+		RespondInGroups:     r.boolean("RESPOND_IN_GROUPS", true),
+		GroupRequireMention: r.boolean("GROUP_REQUIRE_MENTION", true),
+		QuoteOriginal:       r.boolean("QUOTE_ORIGINAL", false),
+		LogFormat:           logFormat,
+		LogLevel:            logLevel,
+		HealthAddr:          r.value("HEALTH_ADDR"),
+		ReplyAPIToken:       r.value("REPLY_API_TOKEN"),
+		QRToken:             r.value("QR_TOKEN"),
+		BusinessHours:       businessHours,
+		AfterHoursMessage:   r.str("AFTER_HOURS_MESSAGE", defaultAfterHoursMessage),
+		FreightRates:        rates,
+		Depot:               depot,
+		AIProvider:          strings.ToLower(r.str("AI_PROVIDER", providerOpenAI)),
+		AnthropicKey:        r.value("ANTHROPIC_API_KEY"),
+		AnthropicModel:      r.str("ANTHROPIC_MODEL", "claude-3-5-haiku-latest"),
+		AnthropicBaseURL:    r.str("ANTHROPIC_BASE_URL", "https://api.anthropic.com/v1"),
+		OllamaModel:         r.str("OLLAMA_MODEL", "llama3.1"),
+		OllamaBaseURL:       r.str("OLLAMA_BASE_URL", "http://localhost:11434"),
+		MaxMessageChars:     r.positiveInt("MAX_MESSAGE_CHARS", defaultMaxMessageChars),
+		Multilingual:        r.boolean("MULTILINGUAL", false),
+		LanguagePrompts:     languagePrompts,
+		TranscriptPath:      r.value("TRANSCRIPT_CSV_PATH"),
+		Temperature:         r.temperature("OPENAI_TEMPERATURE", 0.2),
+		MaxTokens:           r.nonNegativeInt("OPENAI_MAX_TOKENS", 0),
+		ChatQueueSize:       r.positiveInt("CHAT_QUEUE_SIZE", 20),
+		MaxDocumentBytes:    int64(r.positiveInt("MAX_DOCUMENT_MB", 5)) << 20,
+		DryRun:              r.boolean("AI_DRY_RUN", false),
+		Debounce:            time.Duration(r.nonNegativeInt("DEBOUNCE_MS", 0)) * time.Millisecond,
+		MaxMediaBytes:       int64(r.positiveInt("MAX_MEDIA_BYTES", 16<<20)),
+		MediaTypes:          parseMediaTypes(r.value("MEDIA_ALLOWED_TYPES")),
+		ReplyTypes:          replyTypes,
+		GreetingReplies:     greetings,
+		ReplyFilters:        filters,
+		SendRatePerSecond:   r.nonNegativeFloat("SEND_RATE_PER_SECOND", 1),
+		ReactionAck:         r.value("REACTION_ACK_MESSAGE"),
+		BlockedKeywords:     blockedKeywords,
+		MaxInputChars:       r.nonNegativeInt("MAX_INPUT_CHARS", 10000),
+		LongInputMode:       strings.ToLower(r.str("LONG_INPUT_MODE", longInputTruncate)),
+		LongInputMessage:    r.str("LONG_INPUT_MESSAGE", defaultLongInputMessage),
+		LongInputNotice:     r.str("LONG_INPUT_NOTICE", defaultLongInputNotice),
+		BlockedReply:        r.value("BLOCKED_MESSAGE_REPLY"),
+		WebhookURL:          r.value("WEBHOOK_URL"),
+		FollowupDelay:       r.duration("FOLLOWUP_DELAY", 0),
+		ReplyDelay:          replyDelay,
+		IgnoreImageCaptions: r.boolean("IGNORE_IMAGE_CAPTIONS", false),
+		FreightExtraction:   r.boolean("FREIGHT_EXTRACTION", false),
+		OptOutKeywords:      parseKeywords(r.str("OPT_OUT_KEYWORDS", "BAJA,STOP")),
+		OptInKeywords:       parseKeywords(r.str("OPT_IN_KEYWORDS", "ALTA,START")),
+		OptOutMessage:       r.str("OPT_OUT_MESSAGE", defaultOptOutMessage),
+		OptInMessage:        r.str("OPT_IN_MESSAGE", defaultOptInMessage),
+		PriceSheetPath:      r.str("PRICE_SHEET_PATH", "data/tarifas.pdf"),
+		PriceSheetCaption:   r.value("PRICE_SHEET_CAPTION"),
+		KnowledgeDir:        r.str("KNOWLEDGE_DIR", "data/conocimiento"),
+		KnowledgeTopK:       r.positiveInt("KNOWLEDGE_TOP_K", 3),
+		KnowledgeChunkChars: r.positiveInt("KNOWLEDGE_CHUNK_CHARS", 800),
+		KnowledgeScoring:    strings.ToLower(r.str("KNOWLEDGE_SCORING", scoringKeyword)),
+		EmbeddingsModel:     r.str("OPENAI_EMBEDDINGS_MODEL", "text-embedding-3-small"),
+		ModerationModel:     r.str("OPENAI_MODERATION_MODEL", "omni-moderation-latest"),
+		Moderation: moderationPolicy{
+			Enabled:      r.boolean("ENABLE_MODERATION", false),
+			Action:       strings.ToLower(r.str("MODERATION_ACTION", moderationBlock)),
+			CheckReplies: r.boolean("MODERATION_CHECK_REPLIES", false),
+			Timeout:      r.seconds("MODERATION_TIMEOUT_SECONDS", 5*time.Second),
+			Message:      r.str("MODERATION_MESSAGE", defaultModerationMessage),
+		},
+		EmbeddingsCachePath:   r.str("EMBEDDINGS_CACHE_PATH", "data/embeddings.json"),
+		FAQPath:               r.str("FAQ_PATH", "data/faq.csv"),
+		FAQThreshold:          r.nonNegativeFloat("FAQ_THRESHOLD", 0.9),
+		MaxConcurrentRequests: r.nonNegativeInt("MAX_CONCURRENT_REQUESTS", 0),
+		ConcurrencyWait:       r.seconds("MAX_CONCURRENT_WAIT_SECONDS", 20*time.Second),
+		AzureKey:              r.value("AZURE_API_KEY"),
+		AzureEndpoint:         r.value("AZURE_ENDPOINT"),
+		AzureDeployment:       r.value("AZURE_DEPLOYMENT"),
+		AzureAPIVersion:       r.str("AZURE_API_VERSION", "2024-06-01"),
+		OpenAIExtraHeaders:    openAIHeaders,
+		OpenAIProxy:           openAIProxy,
+		MessageLog:            r.boolean("MESSAGE_LOG", true),
+		BroadcastDays:         r.positiveInt("BROADCAST_DAYS", 30),
+		ExportMaxBytes:        r.positiveInt("EXPORT_MAX_MB", 2) << 20,
+		MaintenanceMode:       r.boolean("MAINTENANCE_MODE", false),
+		MaintenanceMessage:    r.value("MAINTENANCE_MESSAGE"),
+		ContextMetadata:       r.boolean("INCLUDE_CONTEXT_METADATA", false),
+		Location:              businessTZ,
+		StartupHealthcheck:    r.boolean("STARTUP_HEALTHCHECK", false),
+		SlowReplyThreshold:    time.Duration(r.nonNegativeInt("SLOW_REPLY_THRESHOLD_MS", 0)) * time.Millisecond,
+		SlowReplyMessage:      r.str("SLOW_REPLY_MESSAGE", defaultSlowReplyMessage),
+		BreakerThreshold:      r.nonNegativeInt("AI_BREAKER_THRESHOLD", 5),
+		BreakerCooldown:       r.duration("AI_BREAKER_COOLDOWN", time.Minute),
+		WelcomeMessage:        r.value("WELCOME_MESSAGE"),
+		ReplyCacheTTL:         r.duration("REPLY_CACHE_TTL", 0),
+		ReplyCacheSize:        r.positiveInt("REPLY_CACHE_SIZE", 500),
+		FollowupMessage:       r.str("FOLLOWUP_MESSAGE", defaultFollowupMessage),
+		WebhookSecret:         r.value("WEBHOOK_SECRET"),
+		ErrorMessages: errorMessages{
+			Generic:       r.str("ERROR_MSG_GENERIC", defaultErrorGeneric),
+			Timeout:       r.str("ERROR_MSG_TIMEOUT", defaultErrorTimeout),
+			RateLimit:     r.str("ERROR_MSG_RATE_LIMIT", defaultErrorRateLimit),
+			Busy:          r.str("ERROR_MSG_BUSY", defaultErrorBusy),
+			ContentFilter: r.str("ERROR_MSG_CONTENT_FILTER", defaultErrorContentFilter),
+		},
+	}
+
+	promptKey := "AI_SYSTEM_PROMPT"
+	if promptFile != "" {
+		promptKey = "AI_SYSTEM_PROMPT_FILE"
+	}
+	r.check(validatePromptTemplate(promptKey, cfg.SystemPrompt))
+	r.check(validateBaseURL("OPENAI_BASE_URL", cfg.OpenAIBaseURL))
+	r.check(validateBaseURL("ANTHROPIC_BASE_URL", cfg.AnthropicBaseURL))
+	r.check(validateBaseURL("OLLAMA_BASE_URL", cfg.OllamaBaseURL))
+	for _, model := range []struct{ key, name string }{
+		{"OPENAI_MODEL", cfg.OpenAIModel},
+		{"OPENAI_FALLBACK_MODEL", cfg.OpenAIFallbackModel},
+		{"OPENAI_VISION_MODEL", cfg.VisionModel},
+		{"OPENAI_TRANSCRIBE_MODEL", cfg.TranscribeModel},
+		{"OPENAI_EMBEDDINGS_MODEL", cfg.EmbeddingsModel},
+		{"OPENAI_MODERATION_MODEL", cfg.ModerationModel},
+	} {
+		if strings.ContainsAny(model.name, " \t\"'") {
+			r.check(fmt.Errorf("%s must be a model name such as gpt-4o-mini, got %q", model.key, model.name))
+		}
+	}
+
+	if cfg.FAQThreshold > 1 {
+		r.check(fmt.Errorf("FAQ_THRESHOLD must be a similarity between 0 and 1, got %v", cfg.FAQThreshold))
+	}
+
+	if cfg.FreightExtraction && cfg.AIProvider != providerOpenAI && cfg.AIProvider != providerAzure {
+		r.check(errors.New("FREIGHT_EXTRACTION needs AI_PROVIDER=openai or azure"))
+	}
+
+	if summary := cfg.HistorySummary; summary.threshold > 0 {
+		if summary.threshold > cfg.HistoryLimit {
+			r.check(fmt.Errorf("HISTORY_SUMMARY_THRESHOLD (%d) must not exceed AI_HISTORY_LIMIT (%d), older messages are dropped before they can be summarized", summary.threshold, cfg.HistoryLimit))
+		}
+		if summary.keep >= summary.threshold {
+			r.check(fmt.Errorf("HISTORY_SUMMARY_KEEP (%d) must be lower than HISTORY_SUMMARY_THRESHOLD (%d)", summary.keep, summary.threshold))
+		}
+	}
+
+	if cfg.Moderation.Enabled && !cfg.hasOpenAIAuth() && !cfg.DryRun {
+		r.check(errors.New("OPENAI_API_KEY is required when ENABLE_MODERATION=true"))
+	}
+	if cfg.Moderation.Action != moderationBlock && cfg.Moderation.Action != moderationWarn {
+		r.check(fmt.Errorf("MODERATION_ACTION must be %s or %s", moderationBlock, moderationWarn))
+	}
+
+	if cfg.StreamEdits && !cfg.OpenAIStream {
+		r.check(errors.New("STREAM_EDITS needs OPENAI_STREAM=true"))
+	}
+
+	if cfg.LengthAction != lengthNote && cfg.LengthAction != lengthContinue {
+		r.check(fmt.Errorf("OPENAI_LENGTH_ACTION must be %s or %s", lengthNote, lengthContinue))
+	}
+
+	if cfg.ReplyAPIToken != "" && cfg.HealthAddr == "" {
+		r.check(fmt.Errorf("REPLY_API_TOKEN needs HEALTH_ADDR, POST /reply is served there"))
+	}
+	if cfg.QRToken != "" && cfg.HealthAddr == "" {
+		r.check(fmt.Errorf("QR_TOKEN needs HEALTH_ADDR, /qr is served there"))
+	}
+	if cfg.WhatsAppDisabled && cfg.ReplyAPIToken == "" {
+		r.check(fmt.Errorf("WHATSAPP_DISABLED needs REPLY_API_TOKEN, POST /reply is the only way to reach the bot"))
+	}
+
+	if cfg.LongInputMode != longInputTruncate && cfg.LongInputMode != longInputReject {
+		r.check(fmt.Errorf("LONG_INPUT_MODE must be %s or %s", longInputTruncate, longInputReject))
+	}
+
+	switch cfg.KnowledgeScoring {
+	case scoringKeyword:
+	case scoringEmbeddings:
+		if !cfg.hasOpenAIAuth() && !cfg.DryRun {
+			r.check(errors.New("OPENAI_API_KEY is required when KNOWLEDGE_SCORING=embeddings"))
+		}
+	default:
+		r.check(fmt.Errorf("KNOWLEDGE_SCORING must be %s or %s", scoringKeyword, scoringEmbeddings))
+	}
+
+	switch cfg.AIProvider {
+	case providerOpenAI:
+		if !cfg.hasOpenAIAuth() && !cfg.DryRun {
+			r.check(errors.New("OPENAI_API_KEY is required"))
+		}
+	case providerAnthropic:
+		if cfg.AnthropicKey == "" && !cfg.DryRun {
+			r.check(errors.New("ANTHROPIC_API_KEY is required when AI_PROVIDER=anthropic"))
+		}
+	case providerAzure:
+		if cfg.AzureKey == "" && !cfg.DryRun {
+			r.check(errors.New("AZURE_API_KEY is required when AI_PROVIDER=azure"))
+		}
+		if cfg.AzureDeployment == "" {
+			r.check(errors.New("AZURE_DEPLOYMENT is required when AI_PROVIDER=azure"))
+		}
+		r.check(validateBaseURL("AZURE_ENDPOINT", cfg.AzureEndpoint))
+	case providerOllama:
+	default:
+		r.check(fmt.Errorf("AI_PROVIDER must be one of %s, %s, %s or %s", providerOpenAI, providerAzure, providerAnthropic, providerOllama))
+	}
+
+	cfg.configKeys = r.consulted()
+	if err := r.err(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// configReader reads typed values from a variable map, recording every
+// problem instead of stopping at the first one.
+type configReader struct {
+	vars     map[string]string
+	keys     map[string]struct{}
+	problems []error
+}
+
+func (r *configReader) value(key string) string {
+	r.keys[key] = struct{}{}
+	return strings.TrimSpace(r.vars[key])
+}
+
+func (r *configReader) str(key, fallback string) string {
+	if value := r.value(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (r *configReader) check(err error) {
+	if err != nil {
+		r.problems = append(r.problems, err)
+	}
+}
+
+func (r *configReader) seconds(key string, fallback time.Duration) time.Duration {
+	value, err := parseTimeoutSeconds(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) duration(key string, fallback time.Duration) time.Duration {
+	value, err := parseDuration(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) positiveInt(key string, fallback int) int {
+	value, err := parsePositiveInt(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) nonNegativeInt(key string, fallback int) int {
+	value, err := parseNonNegativeInt(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) temperature(key string, fallback float64) float64 {
+	value, err := parseTemperature(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) nonNegativeFloat(key string, fallback float64) float64 {
+	value, err := parseNonNegativeFloat(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) boolean(key string, fallback bool) bool {
+	value, err := parseBool(key, r.value(key), fallback)
+	r.check(err)
+	return value
+}
+
+func (r *configReader) consulted() []string {
+	keys := make([]string, 0, len(r.keys))
+	for key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *configReader) err() error {
+	if len(r.problems) == 0 {
+		return nil
+	}
+	lines := make([]string, len(r.problems))
+	for i, problem := range r.problems {
+		lines[i] = "  - " + problem.Error()
+	}
+	return fmt.Errorf("invalid configuration (%d problems):\n%s", len(r.problems), strings.Join(lines, "\n"))
+}
+
+// validateBaseURL checks that value is an absolute http or https URL
+// pointing at an API root rather than a specific endpoint.
+func validateBaseURL(key, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute http or https URL, got %q", key, value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%s must not have a query or fragment, got %q", key, value)
+	}
+	for _, endpoint := range []string{"/chat/completions", "/messages", "/api/chat"} {
+		if strings.HasSuffix(strings.TrimRight(u.Path, "/"), endpoint) {
+			return fmt.Errorf("%s must be the API root without %s, got %q", key, endpoint, value)
+		}
+	}
+	return nil
+}
+
+func parseTimeoutSeconds(key, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return fallback, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func parseDuration(key, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return fallback, fmt.Errorf("%s must be a non-negative duration such as 30m or 24h", key)
+	}
+
+	return d, nil
+}
+
+func parsePositiveInt(key, value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fallback, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	return n, nil
+}
+
+func parseNonNegativeInt(key, value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fallback, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+
+	return n, nil
+}
+
+func parseTemperature(key, value string, fallback float64) (float64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := strconv.ParseFloat(value, 64)
+	if err != nil || t < 0 || t > 2 {
+		return fallback, fmt.Errorf("%s must be a number between 0 and 2", key)
+	}
+
+	return t, nil
+}
+
+func parseNonNegativeFloat(key, value string, fallback float64) (float64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return fallback, fmt.Errorf("%s must be a non-negative number", key)
+	}
+
+	return f, nil
+}
+
+func parseBool(key, value string, fallback bool) (bool, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback, fmt.Errorf("%s must be a boolean", key)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readConfigFile loads CONFIG_FILE into the same variables the environment
+// uses. Nested keys are joined with "_" and uppercased, so both
+// OPENAI_MODEL: x and model: x under openai: set OPENAI_MODEL. Lists become
+// comma separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".yaml", ".yml":
+		tree, err = parseYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: config file must be .json, .yaml or .yml", path)
+	}
+
+	vars := make(map[string]string)
+	if err := flattenConfig(vars, "", tree); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
+
+func flattenConfig(vars map[string]string, prefix string, tree map[string]any) error {
+	for key, value := range tree {
+		name := strings.ToUpper(strings.TrimSpace(key))
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := flattenConfig(vars, name, nested); err != nil {
+				return err
+			}
+			continue
+		}
+		text, err := configScalar(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		vars[name] = text
+	}
+	return nil
+}
+
+func configScalar(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, err := configScalar(item)
+			if err != nil {
+				return "", err
+			}
+			if _, nested := item.([]any); nested {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", value)
+	}
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseYAML understands the YAML a config file needs: nested mappings,
+// block and flow lists of scalars, quoted strings, comments and | or >
+// block scalars for long prompts. Anchors, tags and multiple documents
+// are not supported.
+func parseYAML(data []byte) (map[string]any, error) {
+	var lines []yamlLine
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		raw := strings.TrimRight(scanner.Text(), " \t\r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", number)
+		}
+		if text == "---" && len(lines) == 0 {
+			continue
+		}
+		lines = append(lines, yamlLine{number: number, indent: len(raw) - len(text), text: text})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.pos == len(p.lines) {
+		return map[string]any{}, nil
+	}
+	tree, err := p.mapping(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return tree, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func isYAMLBlank(text string) bool {
+	return text == "" || strings.HasPrefix(text, "#")
+}
+
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && isYAMLBlank(p.lines[p.pos].text) {
+		p.pos++
+	}
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	tree := make(map[string]any)
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent; p.skipBlank() {
+		line := p.lines[p.pos]
+		key, rest, ok := cutYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", line.number)
+		}
+		if _, dup := tree[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+
+		value, err := p.value(line, rest, indent)
+		if err != nil {
+			return nil, err
+		}
+		tree[key] = value
+	}
+	return tree, nil
+}
+
+func (p *yamlParser) value(line yamlLine, rest string, indent int) (any, error) {
+	rest = stripYAMLComment(rest)
+	switch {
+	case rest == "|" || rest == "|-" || rest == ">" || rest == ">-":
+		return p.blockScalar(rest, indent), nil
+	case rest != "":
+		return yamlScalar(line.number, rest)
+	}
+
+	p.skipBlank()
+	if p.pos == len(p.lines) || p.lines[p.pos].indent < indent {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent == indent && !strings.HasPrefix(next.text, "- ") && next.text != "-" {
+		return nil, nil
+	}
+	if strings.HasPrefix(next.text, "- ") || next.text == "-" {
+		return p.sequence(next.indent)
+	}
+	if next.indent <= indent {
+		return nil, nil
+	}
+	return p.mapping(next.indent)
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	var items []any
+	for p.skipBlank(); p.pos < len(p.lines) && p.lines[p.pos].indent == indent; p.skipBlank() {
+		line := p.lines[p.pos]
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			break
+		}
+		item := stripYAMLComment(strings.TrimSpace(strings.TrimPrefix(line.text, "-")))
+		if _, _, isMap := cutYAMLKey(item); isMap && !strings.HasPrefix(item, "\"") && !strings.HasPrefix(item, "'") {
+			return nil, fmt.Errorf("line %d: lists of mappings are not supported", line.number)
+		}
+		value, err := yamlScalar(line.number, item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		p.pos++
+	}
+	return items, nil
+}
+
+// blockScalar reads the lines indented under a | or > indicator.
+func (p *yamlParser) blockScalar(style string, indent int) string {
+	var parts []string
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := p.lines[p.pos]
+		if line.text == "" {
+			parts = append(parts, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		parts = append(parts, strings.Repeat(" ", max(line.indent-blockIndent, 0))+line.text)
+	}
+	for len(parts) > 0 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+
+	text := strings.Join(parts, "\n")
+	if strings.HasPrefix(style, ">") {
+		text = foldLines(parts)
+	}
+	if !strings.HasSuffix(style, "-") {
+		text += "\n"
+	}
+	return text
+}
+
+// foldLines joins the lines of a > block with spaces; a blank line stands
+// for a line break instead.
+func foldLines(parts []string) string {
+	var b strings.Builder
+	for i, part := range parts {
+		switch {
+		case part == "":
+			b.WriteString("\n")
+		case i > 0 && parts[i-1] != "":
+			b.WriteString(" " + part)
+		default:
+			b.WriteString(part)
+		}
+	}
+	return b.String()
+}
+
+func cutYAMLKey(text string) (key, rest string, ok bool) {
+	if i := strings.Index(text, ": "); i > 0 {
+		key, rest = text[:i], text[i+2:]
+	} else if strings.HasSuffix(text, ":") && len(text) > 1 {
+		key = text[:len(text)-1]
+	} else {
+		return "", "", false
+	}
+	key = strings.Trim(strings.TrimSpace(key), "\"'")
+	return key, strings.TrimSpace(rest), key != ""
+}
+
+func stripYAMLComment(text string) string {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		if end := closingQuote(text); end > 0 && strings.HasPrefix(strings.TrimSpace(text[end+1:]), "#") {
+			return text[:end+1]
+		}
+		return strings.TrimSpace(text)
+	}
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = text[:i]
+	}
+	if strings.HasPrefix(text, "#") {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// closingQuote returns the index of the quote ending the string that text
+// starts with, or -1.
+func closingQuote(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlScalar(number int, text string) (any, error) {
+	switch {
+	case text == "" || text == "~" || text == "null":
+		return nil, nil
+	case strings.HasPrefix(text, "\""):
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string", number)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: unterminated quoted string", number)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "{"):
+		return nil, fmt.Errorf("line %d: flow mappings are not supported, use an indented block", number)
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated list", number)
+		}
+		var items []any
+		for _, item := range strings.Split(text[1:len(text)-1], ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := yamlScalar(number, item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadConfigFile(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		want                map[string]string
+	}{
+		{
+			name: "nested maps",
+			file: "config.yaml",
+			content: `---
+OPENAI_MODEL: gpt-4o-mini
+openai:
+  timeout_seconds: 30
+  extra:
+    headers: X-Team=fletes
+ventas:
+  whatsapp_db_path: data/ventas.db
+log_level:
+`,
+			want: map[string]string{
+				"OPENAI_MODEL":            "gpt-4o-mini",
+				"OPENAI_TIMEOUT_SECONDS":  "30",
+				"OPENAI_EXTRA_HEADERS":    "X-Team=fletes",
+				"VENTAS_WHATSAPP_DB_PATH": "data/ventas.db",
+				"LOG_LEVEL":               "",
+			},
+		},
+		{
+			name: "block and flow lists",
+			file: "config.yml",
+			content: `admin:
+  numbers:
+    - 5491122223333
+    - "5491144445555"
+contact:
+  allowlist: [5491122223333, '5491166667777']
+  blocklist: []
+groups:
+- ventas@g.us
+- soporte@g.us
+`,
+			want: map[string]string{
+				"ADMIN_NUMBERS":     "5491122223333,5491144445555",
+				"CONTACT_ALLOWLIST": "5491122223333,5491166667777",
+				"CONTACT_BLOCKLIST": "",
+				"GROUPS":            "ventas@g.us,soporte@g.us",
+			},
+		},
+		{
+			name: "block scalars",
+			file: "config.yaml",
+			content: `literal: |
+  Sos un asistente.
+    - breve
+
+  Responde en espanol.
+stripped: |-
+  sin salto final
+folded: >
+  una linea
+  larga
+
+  otro parrafo
+folded_stripped: >-
+  doblada
+  sin salto
+after: ok
+`,
+			want: map[string]string{
+				"LITERAL":         "Sos un asistente.\n  - breve\n\nResponde en espanol.\n",
+				"STRIPPED":        "sin salto final",
+				"FOLDED":          "una linea larga\notro parrafo\n",
+				"FOLDED_STRIPPED": "doblada sin salto",
+				"AFTER":           "ok",
+			},
+		},
+		{
+			name: "comments",
+			file: "config.yaml",
+			content: `# leading comment
+plain: valor # comment
+hash: a#b
+double: "a # b" # comment
+single: 'c # d'   # comment
+section: # comment
+  # inside the section
+  key: x
+`,
+			want: map[string]string{
+				"PLAIN":       "valor",
+				"HASH":        "a#b",
+				"DOUBLE":      "a # b",
+				"SINGLE":      "c # d",
+				"SECTION_KEY": "x",
+			},
+		},
+		{
+			name: "quotes and escapes",
+			file: "config.yaml",
+			content: `double: "linea 1\nlinea 2 \"citada\" á"
+single: 'it''s "ok"'
+"quoted_key": valor
+empty: ""
+`,
+			want: map[string]string{
+				"DOUBLE":     "linea 1\nlinea 2 \"citada\" á",
+				"SINGLE":     `it's "ok"`,
+				"QUOTED_KEY": "valor",
+				"EMPTY":      "",
+			},
+		},
+		{
+			name: "json",
+			file: "config.json",
+			content: `{
+  "OPENAI_MODEL": "gpt-4o",
+  "openai": {"timeout_seconds": 30, "temperature": 0.2, "stream": true},
+  "admin": {"numbers": ["5491122223333", 5491144445555]},
+  "log_level": null
+}`,
+			want: map[string]string{
+				"OPENAI_MODEL":           "gpt-4o",
+				"OPENAI_TIMEOUT_SECONDS": "30",
+				"OPENAI_TEMPERATURE":     "0.2",
+				"OPENAI_STREAM":          "true",
+				"ADMIN_NUMBERS":          "5491122223333,5491144445555",
+				"LOG_LEVEL":              "",
+			},
+		},
+		{
+			name:    "empty yaml",
+			file:    "config.yaml",
+			content: "# nothing here\n\n",
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readConfigFile(writeConfigFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("readConfigFile: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d keys %q, want %d", len(got), got, len(tt.want))
+			}
+			for key, want := range tt.want {
+				if value, ok := got[key]; !ok || value != want {
+					t.Errorf("%s = %q (set %v), want %q", key, value, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"duplicate key", "config.yaml", "openai:\n  model: a\n  model: b\n", `line 3: duplicate key "model"`},
+		{"list of maps", "config.yaml", "accounts:\n  - name: ventas\n    db: a.db\n", "line 2: lists of mappings are not supported"},
+		{"flow mapping", "config.yaml", "ventas: {whatsapp_db_path: a.db}\n", "line 1: flow mappings are not supported"},
+		{"bad indentation", "config.yaml", "openai:\n    model: a\n  timeout: 30\n", "line 3: unexpected indentation"},
+		{"over indented key", "config.yaml", "model: a\n  timeout: 30\n", "line 2: unexpected indentation"},
+		{"tab indentation", "config.yaml", "openai:\n\tmodel: a\n", "line 2: tabs are not allowed"},
+		{"missing colon", "config.yaml", "openai\n", "line 1: expected key: value"},
+		{"unterminated double quote", "config.yaml", "model: \"gpt\n", "line 1: invalid quoted string"},
+		{"unterminated single quote", "config.yaml", "model: 'gpt\n", "line 1: unterminated quoted string"},
+		{"unterminated flow list", "config.yaml", "admins: [a, b\n", "line 1: unterminated list"},
+		{"nested json list", "config.json", `{"admins": [["a"]]}`, "ADMINS: nested lists are not supported"},
+		{"json list of objects", "config.json", `{"admins": [{"a": 1}]}`, "ADMINS: unsupported value"},
+		{"invalid json", "config.json", `{"model": }`, "parse "},
+		{"unknown extension", "config.toml", "model = 'a'\n", "config file must be .json, .yaml or .yml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readConfigFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigVarsEnvironmentOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `openai:
+  model: gpt-4o-mini
+log:
+  level: debug
+history_limit: 10
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("OPENAI_MODEL", "gpt-4o")
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("HISTORY_LIMIT", "  ")
+
+	vars, fileKeys, err := configVars()
+	if err != nil {
+		t.Fatalf("configVars: %v", err)
+	}
+	want := map[string]string{"OPENAI_MODEL": "gpt-4o", "LOG_LEVEL": "debug", "HISTORY_LIMIT": "10"}
+	for key, value := range want {
+		if vars[key] != value {
+			t.Errorf("%s = %q, want %q", key, vars[key], value)
+		}
+		if !fileKeys[key] {
+			t.Errorf("%s not reported as a file key", key)
+		}
+	}
+	if vars["CONFIG_FILE"] != path {
+		t.Errorf("CONFIG_FILE = %q, want the environment value", vars["CONFIG_FILE"])
+	}
+
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, _, err := configVars(); err == nil || !strings.HasPrefix(err.Error(), "CONFIG_FILE: ") {
+		t.Errorf("missing file: error = %v, want a CONFIG_FILE error", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+type contactSet map[string]struct{}
+
+func parseContactSet(key, value string) (contactSet, error) {
+	set := contactSet{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		normalized, err := normalizeContact(item)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		set[normalized] = struct{}{}
+	}
+	return set, nil
+}
+
+// normalizeContact accepts a bare phone number ("+54 9 11 1234-5678") or a
+// full JID and returns the JID string without device suffix.
+func normalizeContact(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "@") {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, value)
+		if digits == "" {
+			return "", fmt.Errorf("invalid contact %q", value)
+		}
+		return types.NewJID(digits, types.DefaultUserServer).String(), nil
+	}
+
+	jid, err := types.ParseJID(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid contact %q: %w", value, err)
+	}
+	return jid.ToNonAD().String(), nil
+}
+
+func (s contactSet) Contains(jid types.JID) bool {
+	_, ok := s[jid.ToNonAD().String()]
+	return ok
+}
+
+func (b *Bot) contactAllowed(evt *events.Message) bool {
+	if b.blocklist.Contains(evt.Info.Chat) || b.blocklist.Contains(evt.Info.Sender) {
+		return false
+	}
+	// CONTACT_ALLOWLIST filters WhatsApp contacts; web chats are already
+	// authorized by REPLY_API_TOKEN.
+	if len(b.allowlist) > 0 && evt.Info.Chat.Server != webServer && !b.allowlist.Contains(evt.Info.Chat) {
+		return false
+	}
+	return true
+}
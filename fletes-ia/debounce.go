@@ -0,0 +1,125 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// collect keeps reading from queue until debounce passes without a new
+// message, capped at the queue size so a chatty customer still gets answered.
+func (q *chatQueue) collect(first *events.Message, queue chan *events.Message) []*events.Message {
+	batch := []*events.Message{first}
+	if q.debounce <= 0 {
+		return batch
+	}
+
+	for len(batch) < q.size {
+		select {
+		case evt := <-queue:
+			batch = append(batch, evt)
+		case <-time.After(q.debounce):
+			return batch
+		}
+	}
+	return batch
+}
+
+// debouncedMessage is a message to handle; merged lists the IDs of the
+// earlier messages folded into it, which must count as seen as well.
+type debouncedMessage struct {
+	evt    *events.Message
+	merged []types.MessageID
+}
+
+// mergeDebounced joins runs of plain text messages from the same sender into
+// a single message carrying the last one's metadata. Media, commands and
+// everything else pass through untouched and in order.
+func mergeDebounced(batch []*events.Message) []debouncedMessage {
+	var out []debouncedMessage
+	var run []*events.Message
+
+	flush := func() {
+		switch len(run) {
+		case 0:
+		case 1:
+			out = append(out, debouncedMessage{evt: run[0]})
+		default:
+			texts := make([]string, len(run))
+			ids := make([]types.MessageID, 0, len(run)-1)
+			for i, evt := range run {
+				texts[i] = extractMessageText(evt.Message, true)
+				if i < len(run)-1 {
+					ids = append(ids, evt.Info.ID)
+				}
+			}
+			merged := *run[len(run)-1]
+			merged.Message = &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+				Text:        proto.String(strings.Join(texts, "\n")),
+				ContextInfo: mergedContextInfo(run),
+			}}
+			out = append(out, debouncedMessage{evt: &merged, merged: ids})
+		}
+		run = nil
+	}
+
+	for _, evt := range batch {
+		if !mergeable(evt) {
+			flush()
+			out = append(out, debouncedMessage{evt: evt})
+			continue
+		}
+		if len(run) > 0 && run[0].Info.Sender.ToNonAD() != evt.Info.Sender.ToNonAD() {
+			flush()
+		}
+		run = append(run, evt)
+	}
+	flush()
+	return out
+}
+
+// mergedContextInfo keeps what group mentions and quoting read from a run:
+// the first quoted message and the mentions of every message.
+func mergedContextInfo(run []*events.Message) *waProto.ContextInfo {
+	var merged *waProto.ContextInfo
+	var mentions []string
+	for _, evt := range run {
+		info := messageContextInfo(evt.Message)
+		if info == nil {
+			continue
+		}
+		if merged == nil || merged.GetStanzaID() == "" && info.GetStanzaID() != "" {
+			merged = proto.Clone(info).(*waProto.ContextInfo)
+		}
+		for _, jid := range info.GetMentionedJID() {
+			if !slices.Contains(mentions, jid) {
+				mentions = append(mentions, jid)
+			}
+		}
+	}
+	if merged != nil {
+		merged.MentionedJID = mentions
+	}
+	return merged
+}
+
+func mergeable(evt *events.Message) bool {
+	msg := evt.Message
+	if evt.Info.IsFromMe || msg == nil {
+		return false
+	}
+	if msg.GetImageMessage() != nil || msg.GetAudioMessage() != nil || msg.GetDocumentMessage() != nil {
+		return false
+	}
+	text := extractMessageText(msg, true)
+	if text == "" {
+		return false
+	}
+	_, _, isCommand := parseCommand(text)
+	return !isCommand
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+type seenCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type seenEntry struct {
+	key    string
+	seenAt time.Time
+}
+
+func newSeenCache(size int, ttl time.Duration) *seenCache {
+	return &seenCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Seen records key and reports whether it was already recorded within the TTL.
+func (c *seenCache) Seen(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.expire(now)
+
+	if _, ok := c.entries[key]; ok {
+		return true
+	}
+
+	c.entries[key] = c.order.PushBack(&seenEntry{key: key, seenAt: now})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+	return false
+}
+
+// Forget drops key, so the next Seen for it reports false.
+func (c *seenCache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// seenKey identifies an inbound message for the redelivery check.
+func seenKey(chat types.JID, id types.MessageID) string {
+	return chat.ToNonAD().String() + "/" + id
+}
+
+// markSeen records the IDs of messages merged by the debounce into a later
+// one, so a redelivery of any of them is not answered again.
+func (b *Bot) markSeen(chat types.JID, ids []types.MessageID) {
+	for _, id := range ids {
+		b.seen.Seen(seenKey(chat, id))
+	}
+}
+
+// outboundKey identifies a reply by the inbound message it answers and its
+// content, so reprocessing that message doesn't send the reply twice while
+// the same text answering another message still goes out.
+func outboundKey(chat types.JID, replyTo types.MessageID, kind, text string) string {
+	sum := sha256.Sum256([]byte(chat.ToNonAD().String() + "\x00" + replyTo + "\x00" + kind + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *seenCache) expire(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*seenEntry).seenAt) < c.ttl {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+func (c *seenCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*seenEntry).key)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+const (
+	maxDocumentChars        = 8000
+	documentUnreadableReply = "No pude leer ese archivo. ¿Podrias contarme en un mensaje que contiene?"
+	documentTooLargeReply   = "El archivo es demasiado grande para leerlo. ¿Podrias contarme en un mensaje que contiene?"
+)
+
+var (
+	errUnsupportedDocument = errors.New("unsupported document type")
+	errDocumentTooLarge    = errors.New("document too large")
+)
+
+type documentKind int
+
+const (
+	documentUnsupported documentKind = iota
+	documentPDF
+	documentXLSX
+	documentText
+)
+
+func classifyDocument(doc *waProto.DocumentMessage) documentKind {
+	switch mime := strings.ToLower(strings.TrimSpace(strings.SplitN(doc.GetMimetype(), ";", 2)[0])); mime {
+	case "application/pdf":
+		return documentPDF
+	case "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":
+		return documentXLSX
+	case "text/plain", "text/csv":
+		return documentText
+	}
+
+	switch strings.ToLower(filepath.Ext(doc.GetFileName())) {
+	case ".pdf":
+		return documentPDF
+	case ".xlsx":
+		return documentXLSX
+	case ".txt", ".csv":
+		return documentText
+	}
+	return documentUnsupported
+}
+
+// documentPrompt downloads doc and returns its text, prefixed with the file
+// name and the caption and truncated to maxDocumentChars.
+func documentPrompt(ctx context.Context, client *whatsmeow.Client, policy mediaPolicy, doc *waProto.DocumentMessage, maxBytes int64) (string, error) {
+	kind := classifyDocument(doc)
+	if kind == documentUnsupported {
+		return "", errUnsupportedDocument
+	}
+	if maxBytes > 0 && int64(doc.GetFileLength()) > maxBytes {
+		return "", errDocumentTooLarge
+	}
+
+	data, _, err := downloadMedia(ctx, client, doc, policy)
+	if err != nil {
+		return "", fmt.Errorf("download document: %w", err)
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return "", errDocumentTooLarge
+	}
+
+	var content string
+	switch kind {
+	case documentPDF:
+		content, err = extractPDFText(data)
+	case documentXLSX:
+		content, err = extractXLSXText(data)
+	case documentText:
+		if !utf8.Valid(data) {
+			err = errors.New("document is not valid UTF-8")
+		}
+		content = string(data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	content = cleanDocumentText(content)
+	if content == "" {
+		return "", errors.New("document has no readable text")
+	}
+	if runes := []rune(content); len(runes) > maxDocumentChars {
+		content = string(runes[:maxDocumentChars]) + "\n[...]"
+	}
+
+	var b strings.Builder
+	if caption := strings.TrimSpace(doc.GetCaption()); caption != "" {
+		b.WriteString(caption)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "[documento %s]\n%s", doc.GetFileName(), content)
+	return b.String(), nil
+}
+
+func documentErrorReply(err error) string {
+	if errors.Is(err, errDocumentTooLarge) || errors.Is(err, errMediaTooLarge) {
+		return documentTooLargeReply
+	}
+	return documentUnreadableReply
+}
+
+// cleanDocumentText drops control characters and collapses blank lines.
+func cleanDocumentText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) && r != utf8.RuneError {
+			return r
+		}
+		return -1
+	}, text)
+
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if line == "" && (len(kept) == 0 || kept[len(kept)-1] == "") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
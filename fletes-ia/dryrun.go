@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"strings"
+)
+
+const dryRunPrefix = "[dry-run] "
+
+// DryRunClient answers without calling any API by echoing the last user
+// message, so the rest of the pipeline can be exercised for free.
+type DryRunClient struct{}
+
+func (DryRunClient) Reply(ctx context.Context, messages []chatMessage) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return dryRunPrefix + strings.TrimSpace(messages[i].Content), nil
+		}
+	}
+	return dryRunPrefix + "sin mensaje", nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// streamEditInterval spaces out the edits of a streaming reply; WhatsApp
+	// rate limits edits much like new messages.
+	streamEditInterval = 1500 * time.Millisecond
+	streamEditCursor   = " …"
+)
+
+type streamDeltasKey struct{}
+
+// withStreamDeltas makes streaming providers hand every piece of the reply
+// to onDelta as it arrives.
+func withStreamDeltas(ctx context.Context, onDelta func(string)) context.Context {
+	return context.WithValue(ctx, streamDeltasKey{}, onDelta)
+}
+
+func streamDeltas(ctx context.Context) func(string) {
+	onDelta, _ := ctx.Value(streamDeltasKey{}).(func(string))
+	return onDelta
+}
+
+// inProgressReplies tracks, per chat, the message a streaming reply is
+// being written into.
+type inProgressReplies struct {
+	mu  sync.Mutex
+	ids map[string]types.MessageID
+}
+
+func (p *inProgressReplies) Get(chat types.JID) (types.MessageID, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, ok := p.ids[chat.ToNonAD().String()]
+	return id, ok
+}
+
+func (p *inProgressReplies) Set(chat types.JID, id types.MessageID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ids == nil {
+		p.ids = make(map[string]types.MessageID)
+	}
+	p.ids[chat.ToNonAD().String()] = id
+}
+
+func (p *inProgressReplies) Clear(chat types.JID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.ids, chat.ToNonAD().String())
+}
+
+// sendOrEdit writes text into the chat's in-progress reply, or sends it as
+// a new message that becomes the in-progress reply. Unlike sendMessage it
+// doesn't log or deduplicate: the finished reply is logged once by
+// streamEditor.Finish.
+func (b *Bot) sendOrEdit(ctx context.Context, chat types.JID, text string) bool {
+	msg := &waProto.Message{Conversation: proto.String(text)}
+	id, editing := b.inProgress.Get(chat)
+	if editing {
+		msg = b.client.BuildEdit(chat, id, msg)
+	}
+	if err := b.sendThrottle.Wait(ctx); err != nil {
+		return false
+	}
+	resp, err := b.sender.SendMessage(ctx, chat, msg)
+	if err != nil {
+		if !aborted(ctx, err) {
+			b.log.Warn("streaming edit failed, sending the reply as a new message", "chat", chat, "editing", editing, "error", err)
+		}
+		return false
+	}
+	if !editing {
+		b.inProgress.Set(chat, resp.ID)
+	}
+	return true
+}
+
+// streamEditor shows a streaming reply as it is generated: the first pieces
+// are sent as a message that is then edited in place, at most every
+// streamEditInterval. Edits run in the background so they never hold up the
+// stream.
+type streamEditor struct {
+	bot    *Bot
+	ctx    context.Context
+	chat   types.JID
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	text    strings.Builder
+	started bool
+	failed  bool
+
+	wake chan struct{}
+	done chan struct{}
+	stop chan struct{}
+	once sync.Once
+}
+
+func (b *Bot) newStreamEditor(ctx context.Context, chat types.JID, logger *slog.Logger) *streamEditor {
+	e := &streamEditor{
+		bot:    b,
+		ctx:    ctx,
+		chat:   chat,
+		logger: logger,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *streamEditor) halt() {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+}
+
+// Abandon stops the live edits without touching what was already shown.
+func (e *streamEditor) Abandon() {
+	if e == nil {
+		return
+	}
+	e.halt()
+	e.bot.inProgress.Clear(e.chat)
+}
+
+// Add is the onDelta callback for withStreamDeltas.
+func (e *streamEditor) Add(delta string) {
+	e.mu.Lock()
+	e.text.WriteString(delta)
+	e.mu.Unlock()
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *streamEditor) run() {
+	defer close(e.done)
+	shown := ""
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.wake:
+		}
+
+		e.mu.Lock()
+		text, failed := strings.TrimSpace(e.text.String()), e.failed
+		e.mu.Unlock()
+		if failed || text == "" || text == shown {
+			continue
+		}
+		ok := e.bot.sendOrEdit(e.ctx, e.chat, text+streamEditCursor)
+		e.mu.Lock()
+		e.started = e.started || ok
+		e.failed = !ok
+		e.mu.Unlock()
+		shown = text
+
+		select {
+		case <-e.stop:
+			return
+		case <-time.After(streamEditInterval):
+		}
+	}
+}
+
+// Finish stops the live edits and writes reply, which may differ from the
+// streamed text (an error or moderation message), into the in-progress
+// message. Text past maxMessageChars follows as new messages. It reports
+// false when nothing was delivered and the caller should send reply
+// normally.
+func (e *streamEditor) Finish(reply string) bool {
+	if e == nil {
+		return false
+	}
+	e.halt()
+	defer e.bot.inProgress.Clear(e.chat)
+
+	e.mu.Lock()
+	started, failed := e.started, e.failed
+	e.mu.Unlock()
+	if !started {
+		return false
+	}
+	id, _ := e.bot.inProgress.Get(e.chat)
+
+	chunks := splitMessage(reply, e.bot.maxMessageChars)
+	if failed || len(chunks) == 0 || !e.bot.sendOrEdit(e.ctx, e.chat, chunks[0]) {
+		// The customer already saw part of the reply; all of it comes again
+		// as separate messages.
+		return false
+	}
+	e.logger.Debug("streaming reply edited in place", "message_id", id)
+	e.bot.logMessage(e.ctx, loggedMessage{
+		Chat:      e.chat.ToNonAD().String(),
+		ID:        id,
+		Sender:    e.bot.ownJID(),
+		Direction: directionOut,
+		Type:      "text",
+		Text:      chunks[0],
+		At:        time.Now(),
+	})
+	for _, chunk := range chunks[1:] {
+		if !e.bot.sendText(e.ctx, e.chat, chunk) {
+			break
+		}
+	}
+	return true
+}
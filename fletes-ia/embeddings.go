@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// embedBatchSize keeps each /embeddings request well under the input limit.
+const embedBatchSize = 100
+
+// Embedder turns texts into vectors, one per text and in the same order.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (c *OpenAIClient) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, err := json.Marshal(embeddingsRequest{Model: c.embeddingsModel, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+
+	var vectors [][]float64
+	err = c.withRetry(ctx, func() error {
+		resp, err := c.post(ctx, "/embeddings", body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+
+		var parsed embeddingsResponse
+		if err := json.Unmarshal(respBody, &parsed); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		if len(parsed.Data) != len(texts) {
+			return fmt.Errorf("openai returned %d embeddings for %d inputs", len(parsed.Data), len(texts))
+		}
+
+		vectors = make([][]float64, len(texts))
+		for _, item := range parsed.Data {
+			if item.Index < 0 || item.Index >= len(texts) {
+				return fmt.Errorf("openai returned embedding index %d out of range", item.Index)
+			}
+			vectors[item.Index] = item.Embedding
+		}
+		return nil
+	})
+	return vectors, err
+}
+
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// EmbeddingsClient wraps an Embedder with a disk cache for texts that are
+// embedded on every start, such as FAQ questions and knowledge chunks, so
+// they are only sent to the API when they change. Queries go straight
+// through Embed and are never stored.
+type EmbeddingsClient struct {
+	embedder Embedder
+	model    string
+	path     string
+
+	mu      sync.Mutex
+	vectors map[string][]float64
+	used    map[string]bool
+	dirty   bool
+}
+
+// NewEmbeddingsClient loads the cache at path; an empty path keeps it in
+// memory only.
+func NewEmbeddingsClient(embedder Embedder, model, path string) (*EmbeddingsClient, error) {
+	c := &EmbeddingsClient{
+		embedder: embedder,
+		model:    model,
+		path:     path,
+		vectors:  map[string][]float64{},
+		used:     map[string]bool{},
+	}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read embeddings cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.vectors); err != nil {
+		return nil, fmt.Errorf("decode embeddings cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *EmbeddingsClient) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	return c.embedder.Embed(ctx, texts)
+}
+
+func (c *EmbeddingsClient) key(text string) string {
+	sum := sha256.Sum256([]byte(c.model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// EmbedStored is Embed for corpus texts: vectors come from the cache when
+// possible and new ones are kept for Save.
+func (c *EmbeddingsClient) EmbedStored(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	var missing []int
+
+	c.mu.Lock()
+	for i, text := range texts {
+		key := c.key(text)
+		c.used[key] = true
+		if vector, ok := c.vectors[key]; ok {
+			vectors[i] = vector
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	c.mu.Unlock()
+
+	for start := 0; start < len(missing); start += embedBatchSize {
+		batch := missing[start:min(start+embedBatchSize, len(missing))]
+		inputs := make([]string, len(batch))
+		for i, index := range batch {
+			inputs[i] = texts[index]
+		}
+		embedded, err := c.embedder.Embed(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		for i, index := range batch {
+			vectors[index] = embedded[i]
+			c.vectors[c.key(texts[index])] = embedded[i]
+		}
+		c.dirty = true
+		c.mu.Unlock()
+	}
+	return vectors, nil
+}
+
+// Save writes the cache, keeping only the vectors requested since start so
+// edited or deleted texts don't pile up.
+func (c *EmbeddingsClient) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" || (!c.dirty && len(c.used) == len(c.vectors)) {
+		return nil
+	}
+
+	kept := make(map[string][]float64, len(c.used))
+	for key := range c.used {
+		if vector, ok := c.vectors[key]; ok {
+			kept[key] = vector
+		}
+	}
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return fmt.Errorf("encode embeddings cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("write embeddings cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write embeddings cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write embeddings cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("write embeddings cache: %w", err)
+	}
+	c.vectors, c.dirty = kept, false
+	return nil
+}
+
+// vectorStore is a small in-memory index searched by brute force, which is
+// plenty for a few hundred FAQ entries.
+type vectorStore struct {
+	vectors [][]float64
+}
+
+func (s *vectorStore) Add(vector []float64) int {
+	s.vectors = append(s.vectors, vector)
+	return len(s.vectors) - 1
+}
+
+// Nearest returns the index of the stored vector most similar to query and
+// its cosine similarity, or -1 when the store is empty.
+func (s *vectorStore) Nearest(query []float64) (int, float64) {
+	best, bestScore := -1, 0.0
+	for i, vector := range s.vectors {
+		if score := cosineSimilarity(query, vector); best < 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best, bestScore
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type dotEnvEntry struct {
+	key   string
+	value string
+}
+
+// loadDotEnv copies the variables in path into the process environment and
+// returns the keys it applied. Existing variables win unless ENV_OVERRIDE is
+// true, either in the process environment or in the file itself.
+func loadDotEnv(path string) (map[string]bool, error) {
+	entries, err := readDotEnv(path)
+	if err != nil {
+		return nil, err
+	}
+
+	override := false
+	if value, ok := os.LookupEnv("ENV_OVERRIDE"); ok {
+		override, _ = strconv.ParseBool(strings.TrimSpace(value))
+	} else {
+		for _, entry := range entries {
+			if entry.key == "ENV_OVERRIDE" {
+				override, _ = strconv.ParseBool(entry.value)
+			}
+		}
+	}
+
+	applied := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if _, exists := os.LookupEnv(entry.key); exists && !override && !applied[entry.key] {
+			continue
+		}
+		_ = os.Setenv(entry.key, entry.value)
+		applied[entry.key] = true
+	}
+	return applied, nil
+}
+
+func readDotEnv(path string) ([]dotEnvEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []dotEnvEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		value = strings.Trim(value, "\"'")
+		if key == "" {
+			continue
+		}
+		entries = append(entries, dotEnvEntry{key: key, value: value})
+	}
+
+	return entries, scanner.Err()
+}
+
+// logConfigSources logs, without values, whether each config key came from
+// .env, the process environment, CONFIG_FILE or the built-in default.
+func logConfigSources(logger *slog.Logger, keys []string, dotenv, file map[string]bool) {
+	for _, key := range keys {
+		source := "environment"
+		switch {
+		case strings.TrimSpace(os.Getenv(key)) == "" && file[key]:
+			source = "config file"
+		case strings.TrimSpace(os.Getenv(key)) == "":
+			source = "default"
+		case dotenv[key]:
+			source = ".env"
+		}
+		logger.Debug("config source", "key", key, "source", source)
+	}
+}
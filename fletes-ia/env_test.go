@@ -0,0 +1,289 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeDotEnv(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// unsetEnv clears keys for the test and restores them afterwards.
+func unsetEnv(t *testing.T, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func TestLoadDotEnvMissingFile(t *testing.T) {
+	applied, err := loadDotEnv(filepath.Join(t.TempDir(), "missing.env"))
+	if err != nil {
+		t.Fatalf("loadDotEnv: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("applied = %v, want none", applied)
+	}
+}
+
+func TestLoadDotEnvParsing(t *testing.T) {
+	unsetEnv(t, "ENV_OVERRIDE", "FLETES_PLAIN", "FLETES_EXPORTED", "FLETES_DOUBLE", "FLETES_SINGLE", "FLETES_EMPTY", "FLETES_EQUALS", "FLETES_SPACED", "FLETES_DUP")
+	path := writeDotEnv(t, `
+# comment
+FLETES_PLAIN=value
+export FLETES_EXPORTED=exported
+FLETES_DOUBLE="double quoted"
+FLETES_SINGLE='single quoted'
+FLETES_EMPTY=
+FLETES_EQUALS=a=b=c
+  FLETES_SPACED  =  spaced  
+not a variable
+=no key
+FLETES_DUP=first
+FLETES_DUP=second
+`)
+
+	applied, err := loadDotEnv(path)
+	if err != nil {
+		t.Fatalf("loadDotEnv: %v", err)
+	}
+
+	want := map[string]string{
+		"FLETES_PLAIN":    "value",
+		"FLETES_EXPORTED": "exported",
+		"FLETES_DOUBLE":   "double quoted",
+		"FLETES_SINGLE":   "single quoted",
+		"FLETES_EMPTY":    "",
+		"FLETES_EQUALS":   "a=b=c",
+		"FLETES_SPACED":   "spaced",
+		"FLETES_DUP":      "second",
+	}
+	for key, value := range want {
+		got, ok := os.LookupEnv(key)
+		if !ok || got != value {
+			t.Errorf("%s = %q (set %v), want %q", key, got, ok, value)
+		}
+		if !applied[key] {
+			t.Errorf("%s not reported as applied", key)
+		}
+	}
+	if len(applied) != len(want) {
+		t.Errorf("applied = %v, want %d keys", applied, len(want))
+	}
+}
+
+func TestLoadDotEnvExistingVariablesWin(t *testing.T) {
+	unsetEnv(t, "ENV_OVERRIDE", "FLETES_NEW")
+	t.Setenv("FLETES_SET", "from process")
+	path := writeDotEnv(t, "FLETES_SET=from file\nFLETES_NEW=new\n")
+
+	applied, err := loadDotEnv(path)
+	if err != nil {
+		t.Fatalf("loadDotEnv: %v", err)
+	}
+	if got := os.Getenv("FLETES_SET"); got != "from process" {
+		t.Errorf("FLETES_SET = %q, want the process value", got)
+	}
+	if applied["FLETES_SET"] || !applied["FLETES_NEW"] {
+		t.Errorf("applied = %v", applied)
+	}
+}
+
+func TestLoadDotEnvOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		process string
+		file    string
+		want    string
+	}{
+		{name: "override in file", file: "ENV_OVERRIDE=true\nFLETES_SET=from file\n", want: "from file"},
+		{name: "override in process", process: "true", file: "FLETES_SET=from file\n", want: "from file"},
+		{name: "process disables file override", process: "false", file: "ENV_OVERRIDE=true\nFLETES_SET=from file\n", want: "from process"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unsetEnv(t, "ENV_OVERRIDE")
+			if tt.process != "" {
+				t.Setenv("ENV_OVERRIDE", tt.process)
+			}
+			t.Setenv("FLETES_SET", "from process")
+
+			if _, err := loadDotEnv(writeDotEnv(t, tt.file)); err != nil {
+				t.Fatalf("loadDotEnv: %v", err)
+			}
+			if got := os.Getenv("FLETES_SET"); got != tt.want {
+				t.Errorf("FLETES_SET = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadAccounts(t *testing.T) {
+	dir := t.TempDir()
+	unsetEnv(t, "CONFIG_FILE", "VENTAS_OPENAI_MODEL")
+	t.Setenv("AI_DRY_RUN", "true")
+	t.Setenv("OPENAI_MODEL", "gpt-4o-mini")
+	t.Setenv("WHATSAPP_ACCOUNTS", "ventas, Soporte")
+	t.Setenv("VENTAS_WHATSAPP_DB_PATH", filepath.Join(dir, "ventas.db"))
+	t.Setenv("VENTAS_AI_SYSTEM_PROMPT", "Sos el asistente de ventas.")
+	t.Setenv("SOPORTE_WHATSAPP_DB_PATH", filepath.Join(dir, "soporte.db"))
+	t.Setenv("SOPORTE_OPENAI_MODEL", "gpt-4o")
+
+	accounts, err := loadAccounts()
+	if err != nil {
+		t.Fatalf("loadAccounts: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].name != "ventas" || accounts[1].name != "soporte" {
+		t.Fatalf("accounts = %+v, want ventas and soporte", accounts)
+	}
+	ventas, soporte := accounts[0].cfg, accounts[1].cfg
+	if ventas.SystemPrompt != "Sos el asistente de ventas." || soporte.SystemPrompt == ventas.SystemPrompt {
+		t.Errorf("prompts = %q / %q, want only ventas overridden", ventas.SystemPrompt, soporte.SystemPrompt)
+	}
+	if ventas.OpenAIModel != "gpt-4o-mini" || soporte.OpenAIModel != "gpt-4o" {
+		t.Errorf("models = %q / %q, want the shared one and the override", ventas.OpenAIModel, soporte.OpenAIModel)
+	}
+
+	t.Setenv("SOPORTE_WHATSAPP_DB_PATH", "")
+	t.Setenv("VENTAS_WHATSAPP_DB_PATH", "")
+	if _, err := loadAccounts(); err == nil {
+		t.Error("loadAccounts with a shared WHATSAPP_DB_PATH succeeded, want an error")
+	}
+}
+
+func TestParseTimedPrompts(t *testing.T) {
+	vars := map[string]string{
+		"AI_SYSTEM_PROMPT_PICO":        "Responde en una frase.",
+		"AI_SYSTEM_PROMPT_PICO_HOURS":  "Mon-Fri 08:00-10:00,17:00-19:00",
+		"AI_SYSTEM_PROMPT_NOCHE":       "Podes explayarte.",
+		"AI_SYSTEM_PROMPT_NOCHE_HOURS": "Mon-Sun 22:00-06:00",
+	}
+	value := func(key string) string { return vars[key] }
+
+	prompts, err := parseTimedPrompts("pico, noche", value, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		at   string
+		want string
+	}{
+		{"2026-10-12T09:30:00Z", "pico"},  // Monday rush hour
+		{"2026-10-12T12:00:00Z", ""},      // Monday midday
+		{"2026-10-13T02:00:00Z", "noche"}, // Tuesday, Monday's night window
+		{"2026-10-17T09:30:00Z", ""},      // Saturday
+	} {
+		at, _ := time.Parse(time.RFC3339, tc.at)
+		got, ok := prompts.Select(at)
+		if got.name != tc.want || ok != (tc.want != "") {
+			t.Errorf("Select(%s) = %q, %v, want %q", tc.at, got.name, ok, tc.want)
+		}
+	}
+
+	vars["AI_SYSTEM_PROMPT_NOCHE_HOURS"] = "Fri 18:00-23:00"
+	if _, err := parseTimedPrompts("pico,noche", value, time.UTC); err == nil || !strings.Contains(err.Error(), "overlap on Friday") {
+		t.Errorf("overlapping windows: err = %v, want an overlap error", err)
+	}
+	if _, err := parseTimedPrompts("pico,tarde", value, time.UTC); err == nil {
+		t.Error("missing prompt: want an error")
+	}
+}
+
+func TestWithReloadable(t *testing.T) {
+	started := Config{OpenAIModel: "gpt-4o-mini", HealthAddr: ":8080", ReplyAPIToken: "secreto"}
+	next := Config{OpenAIModel: "gpt-4o", HealthAddr: ":9090"}
+
+	applied := withReloadable(started, next)
+	if applied.OpenAIModel != "gpt-4o" || applied.HealthAddr != ":8080" || applied.ReplyAPIToken != "secreto" {
+		t.Errorf("applied = %+v, want only OPENAI_MODEL reloaded", applied)
+	}
+	// The restart-only changes are reported against the startup values on
+	// every reload, not just the first one.
+	for i := 0; i < 2; i++ {
+		changed, fixed := configChanges(applied, next)
+		if len(changed) != 0 || strings.Join(fixed, ",") != "HealthAddr,ReplyAPIToken" {
+			t.Errorf("reload %d: changed %v, fixed %v", i, changed, fixed)
+		}
+		applied = withReloadable(applied, next)
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	valid := map[string]string{"OPENAI_API_KEY": "sk-test"}
+	with := func(extra map[string]string) map[string]string {
+		vars := map[string]string{}
+		for key, value := range valid {
+			vars[key] = value
+		}
+		for key, value := range extra {
+			vars[key] = value
+		}
+		return vars
+	}
+
+	cfg, err := parseConfig(with(map[string]string{"OPENAI_MODEL": "gpt-4o", "OPENAI_STREAM": "true", "STREAM_EDITS": "true", "AI_HISTORY_LIMIT": "30"}))
+	if err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	if cfg.OpenAIModel != "gpt-4o" || !cfg.StreamEdits || cfg.HistoryLimit != 30 || cfg.AIProvider != providerOpenAI {
+		t.Errorf("cfg = model %q, stream edits %v, history %d, provider %q", cfg.OpenAIModel, cfg.StreamEdits, cfg.HistoryLimit, cfg.AIProvider)
+	}
+
+	for _, tc := range []struct {
+		name string
+		vars map[string]string
+		want string
+	}{
+		{"missing api key", map[string]string{"OPENAI_API_KEY": ""}, "OPENAI_API_KEY is required"},
+		{"invalid number", map[string]string{"AI_HISTORY_LIMIT": "veinte"}, "AI_HISTORY_LIMIT"},
+		{"model with spaces", map[string]string{"OPENAI_MODEL": "gpt 4o"}, "OPENAI_MODEL must be a model name"},
+		{"faq threshold", map[string]string{"FAQ_THRESHOLD": "2"}, "FAQ_THRESHOLD must be a similarity"},
+		{"summary over history", map[string]string{"AI_HISTORY_LIMIT": "10", "HISTORY_SUMMARY_THRESHOLD": "16"}, "must not exceed AI_HISTORY_LIMIT"},
+		{"moderation action", map[string]string{"MODERATION_ACTION": "borrar"}, "MODERATION_ACTION must be"},
+		{"stream edits without streaming", map[string]string{"STREAM_EDITS": "true"}, "STREAM_EDITS needs OPENAI_STREAM=true"},
+		{"length action", map[string]string{"OPENAI_LENGTH_ACTION": "cortar"}, "OPENAI_LENGTH_ACTION must be"},
+		{"reply api without health addr", map[string]string{"REPLY_API_TOKEN": "secreto"}, "REPLY_API_TOKEN needs HEALTH_ADDR"},
+		{"qr token without health addr", map[string]string{"QR_TOKEN": "secreto"}, "QR_TOKEN needs HEALTH_ADDR"},
+		{"whatsapp disabled without reply api", map[string]string{"WHATSAPP_DISABLED": "true"}, "WHATSAPP_DISABLED needs REPLY_API_TOKEN"},
+		{"long input mode", map[string]string{"LONG_INPUT_MODE": "cortar"}, "LONG_INPUT_MODE must be"},
+		{"knowledge scoring", map[string]string{"KNOWLEDGE_SCORING": "magia"}, "KNOWLEDGE_SCORING must be"},
+		{"unknown provider", map[string]string{"AI_PROVIDER": "gemini"}, "AI_PROVIDER must be one of"},
+		{"azure without deployment", map[string]string{"AI_PROVIDER": "azure", "AZURE_API_KEY": "k", "AZURE_ENDPOINT": "https://fletes.openai.azure.com"}, "AZURE_DEPLOYMENT is required"},
+		{"anthropic without key", map[string]string{"AI_PROVIDER": "anthropic"}, "ANTHROPIC_API_KEY is required"},
+		{"reply filters", map[string]string{"REPLY_FILTERS": "emoji"}, "REPLY_FILTERS: unknown filter"},
+		{"language prompt without multilingual", map[string]string{"SYSTEM_PROMPT_EN": "Answer in English."}, "SYSTEM_PROMPT_EN needs MULTILINGUAL=true"},
+	} {
+		_, err := parseConfig(with(tc.vars))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	_, err = parseConfig(map[string]string{"AI_HISTORY_LIMIT": "0", "MODERATION_ACTION": "borrar", "STREAM_EDITS": "true"})
+	if err == nil {
+		t.Fatal("several problems: want an error")
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "invalid configuration (4 problems):\n") {
+		t.Errorf("err = %q, want the four problems counted", msg)
+	}
+	for _, want := range []string{"AI_HISTORY_LIMIT", "MODERATION_ACTION", "STREAM_EDITS", "OPENAI_API_KEY"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("err = %q, want it to list %s", msg, want)
+		}
+	}
+	if got := strings.Count(msg, "\n  - "); got != 4 {
+		t.Errorf("err lists %d problems, want 4 lines:\n%s", got, msg)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	defaultErrorGeneric   = "Lo siento, hubo un error generando la respuesta."
+	defaultErrorTimeout   = "Estoy tardando mas de lo normal en responder. Proba de nuevo en unos minutos, por favor."
+	defaultErrorRateLimit = "Estamos recibiendo muchas consultas en este momento. Proba de nuevo en unos minutos, por favor."
+	defaultErrorBusy      = "Estamos con mucha demanda en este momento. Escribinos de nuevo en un ratito, por favor."
+	// Sent when the provider's content filter withholds the reply.
+	defaultErrorContentFilter = "No podemos responder esa consulta. Si es por un flete, contanos origen, destino y qué querés llevar."
+)
+
+type errorKind int
+
+const (
+	errorGeneric errorKind = iota
+	errorTimeout
+	errorRateLimit
+	errorBusy
+	errorContentFilter
+)
+
+// errorMessages holds the replies sent when a message could not be answered.
+type errorMessages struct {
+	Generic       string
+	Timeout       string
+	RateLimit     string
+	Busy          string
+	ContentFilter string
+}
+
+// classifyReplyError tells timeouts, of the per-message deadline or the
+// provider, rate limits, content filter stops and our own concurrency limit
+// apart from everything else.
+func classifyReplyError(ctx context.Context, err error) errorKind {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errTimeout) {
+		return errorTimeout
+	}
+	if errors.Is(err, errTooBusy) {
+		return errorBusy
+	}
+	if errors.Is(err, errContentFilter) {
+		return errorContentFilter
+	}
+	if errors.Is(err, errRateLimited) {
+		return errorRateLimit
+	}
+	return errorGeneric
+}
+
+func (m errorMessages) forKind(kind errorKind) string {
+	switch kind {
+	case errorTimeout:
+		return m.Timeout
+	case errorRateLimit:
+		return m.RateLimit
+	case errorBusy:
+		return m.Busy
+	case errorContentFilter:
+		return m.ContentFilter
+	default:
+		return m.Generic
+	}
+}
+
+func (m errorMessages) For(ctx context.Context, err error) string {
+	return m.forKind(classifyReplyError(ctx, err))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// exportPageMessages is how many messages one /export document holds.
+const exportPageMessages = 1000
+
+// Export returns page (1 being the latest) of chat's message log, size
+// messages per page, oldest first, along with the chat's total.
+func (l *MessageLog) Export(ctx context.Context, chat string, page, size int) ([]loggedMessage, int, error) {
+	if l == nil {
+		return nil, 0, nil
+	}
+	var total int
+	if err := l.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM fletes_message_log WHERE chat_jid = ?`, chat).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count message log: %w", err)
+	}
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT chat_jid, message_id, sender_jid, direction, type, text, created_at FROM (
+			SELECT * FROM fletes_message_log
+			WHERE chat_jid = ?
+			ORDER BY id DESC
+			LIMIT ? OFFSET ?
+		) ORDER BY id ASC`, chat, size, (page-1)*size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query message log: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []loggedMessage
+	for rows.Next() {
+		var msg loggedMessage
+		var at int64
+		if err := rows.Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.Direction, &msg.Type, &msg.Text, &at); err != nil {
+			return nil, 0, fmt.Errorf("scan message log: %w", err)
+		}
+		msg.At = time.UnixMilli(at)
+		messages = append(messages, msg)
+	}
+	return messages, total, rows.Err()
+}
+
+// renderExport writes messages as a plain text transcript or a CSV file. When
+// that exceeds maxBytes the oldest messages are left out; dropped says how
+// many.
+func renderExport(messages []loggedMessage, format string, loc *time.Location, maxBytes int) (data []byte, dropped int) {
+	render := func(record []string) []byte {
+		var buf bytes.Buffer
+		if format == "csv" {
+			w := csv.NewWriter(&buf)
+			w.Write(record)
+			w.Flush()
+			return buf.Bytes()
+		}
+		fmt.Fprintf(&buf, "[%s] %s: %s\n", record[0], record[2], record[4])
+		return buf.Bytes()
+	}
+
+	var header []byte
+	if format == "csv" {
+		header = render([]string{"fecha", "direccion", "remitente", "tipo", "texto", "message_id"})
+	}
+	rows := make([][]byte, len(messages))
+	for i, msg := range messages {
+		sender := "Bot"
+		if msg.Direction == directionIn {
+			sender = "Cliente"
+			if jid, err := types.ParseJID(msg.Sender); err == nil && jid.User != "" {
+				sender += " " + jid.User
+			}
+		}
+		text := msg.Text
+		if msg.Type != "text" {
+			text = strings.TrimSpace("[" + msg.Type + "] " + text)
+		}
+		if format != "csv" {
+			text = strings.ReplaceAll(text, "\n", "\n    ")
+		}
+		rows[i] = render([]string{msg.At.In(loc).Format("2006-01-02 15:04:05"), msg.Direction, sender, msg.Type, text, msg.ID})
+	}
+
+	size, first := len(header), len(rows)
+	for first > 0 && size+len(rows[first-1]) <= maxBytes {
+		first--
+		size += len(rows[first])
+	}
+	data = append(make([]byte, 0, size), header...)
+	for _, row := range rows[first:] {
+		data = append(data, row...)
+	}
+	return data, first
+}
+
+// cmdExport sends an admin the message log of a chat as a document:
+//
+//	/export <chat> [txt|csv] [pagina]
+//
+// Each page holds exportPageMessages messages, counting back from the
+// latest; a page bigger than EXPORT_MAX_MB loses its oldest messages.
+func cmdExport(ctx context.Context, b *Bot, evt *events.Message, args string) string {
+	if !b.admins.Contains(evt.Info.Sender) {
+		return helpText
+	}
+	if b.messageLog == nil {
+		return "La exportación necesita MESSAGE_LOG=true."
+	}
+
+	const usage = "Uso: /export <número o chat> [txt|csv] [página]"
+	fields := strings.Fields(args)
+	if len(fields) == 0 || !looksLikeContact(fields[0]) {
+		return usage
+	}
+	chat, err := normalizeContact(fields[0])
+	if err != nil {
+		return "No reconozco ese número o chat."
+	}
+	format, page := "txt", 1
+	for _, field := range fields[1:] {
+		switch field = strings.ToLower(field); {
+		case field == "txt" || field == "csv":
+			format = field
+		default:
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 {
+				return usage
+			}
+			page = n
+		}
+	}
+
+	messages, total, err := b.messageLog.Export(ctx, chat, page, exportPageMessages)
+	if err != nil {
+		b.log.Error("export message log failed", "chat", chat, "error", err)
+		return "No pude leer la conversación, probá de nuevo más tarde."
+	}
+	pages := (total + exportPageMessages - 1) / exportPageMessages
+	switch {
+	case total == 0:
+		return "No hay mensajes guardados de " + chat + "."
+	case len(messages) == 0:
+		return fmt.Sprintf("La conversación con %s tiene %d páginas.", chat, pages)
+	}
+
+	data, dropped := renderExport(messages, format, b.location, b.exportMaxBytes)
+	last := total - (page-1)*exportPageMessages
+	first := last - len(messages) + 1 + dropped
+	caption := fmt.Sprintf("Conversación con %s: mensajes %d a %d de %d.", chat, first, last, total)
+	if dropped > 0 {
+		caption += fmt.Sprintf(" Se omitieron los %d más viejos de esta página por superar EXPORT_MAX_MB.", dropped)
+	}
+	if page < pages {
+		caption += fmt.Sprintf(" Los anteriores: /export %s %s %d", fields[0], format, page+1)
+	}
+
+	user, _, _ := strings.Cut(chat, "@")
+	name := fmt.Sprintf("chat-%s-%s", user, time.Now().In(b.location).Format("20060102-150405"))
+	if page > 1 {
+		name += fmt.Sprintf("-p%d", page)
+	}
+	name += "." + format
+	mimeType := "text/plain"
+	if format == "csv" {
+		mimeType = "text/csv"
+	}
+	msg, err := documentMessage(ctx, b.client, data, name, mimeType, caption)
+	if err != nil {
+		b.log.Error("export upload failed", "chat", chat, "error", err)
+		return "No pude subir el archivo, probá de nuevo más tarde."
+	}
+	if !b.sendMessage(ctx, evt.Info.Chat, msg) {
+		return "No pude enviar el archivo, probá de nuevo más tarde."
+	}
+	b.log.Info("chat exported", "chat", chat, "by", evt.Info.Sender, "format", format, "page", page, "messages", len(messages)-dropped, "bytes", len(data))
+	return ""
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// withFallback runs call with the request's model and, when that model is
+// overloaded or unavailable after all retries, once more with the fallback
+// model. It returns the model that produced the answer.
+func (c *OpenAIClient) withFallback(ctx context.Context, payload chatCompletionRequest, call func(body []byte) error) (string, error) {
+	models := []string{payload.Model}
+	if c.fallbackModel != "" && c.fallbackModel != payload.Model {
+		models = append(models, c.fallbackModel)
+	}
+
+	var lastErr error
+	for i, model := range models {
+		payload.Model = model
+		body, err := json.Marshal(adaptRequest(payload))
+		if err != nil {
+			return "", fmt.Errorf("encode payload: %w", err)
+		}
+
+		err = c.withRetry(ctx, func() error {
+			return call(body)
+		})
+		if err == nil {
+			if i > 0 {
+				c.logger.Info("answer produced by fallback model", "model", model, "primary_model", models[0])
+			}
+			return model, nil
+		}
+
+		lastErr = err
+		if !isModelUnavailable(err) || ctx.Err() != nil {
+			break
+		}
+		if i+1 < len(models) {
+			c.logger.Warn("model unavailable, switching to fallback", "model", model, "fallback_model", models[i+1], "error", err)
+		}
+	}
+
+	return "", lastErr
+}
+
+func isModelUnavailable(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return true
+	case apiErr.StatusCode >= http.StatusInternalServerError:
+		return true
+	case apiErr.StatusCode == http.StatusNotFound:
+		return strings.Contains(apiErr.Body, "model_not_found")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type faqEntry struct {
+	Question string
+	Answer   string
+}
+
+// loadFAQ reads a CSV of pregunta,respuesta rows. A missing file disables
+// the FAQ.
+func loadFAQ(path string) ([]faqEntry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var entries []faqEntry
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "pregunta") {
+			continue
+		}
+		if len(record) < 2 || strings.TrimSpace(record[0]) == "" || strings.TrimSpace(record[1]) == "" {
+			return nil, fmt.Errorf("line %d: expected pregunta,respuesta", line)
+		}
+		entries = append(entries, faqEntry{
+			Question: strings.TrimSpace(record[0]),
+			Answer:   strings.TrimSpace(record[1]),
+		})
+	}
+	return entries, nil
+}
+
+// FAQMatcher answers questions that are close enough to a curated FAQ entry
+// without a chat completion.
+type FAQMatcher struct {
+	entries   []faqEntry
+	store     vectorStore
+	client    *EmbeddingsClient
+	threshold float64
+}
+
+func NewFAQMatcher(ctx context.Context, entries []faqEntry, client *EmbeddingsClient, threshold float64) (*FAQMatcher, error) {
+	questions := make([]string, len(entries))
+	for i, entry := range entries {
+		questions[i] = entry.Question
+	}
+	vectors, err := client.EmbedStored(ctx, questions)
+	if err != nil {
+		return nil, fmt.Errorf("embed faq questions: %w", err)
+	}
+
+	m := &FAQMatcher{entries: entries, client: client, threshold: threshold}
+	for _, vector := range vectors {
+		m.store.Add(vector)
+	}
+	return m, nil
+}
+
+// Match returns the FAQ entry most similar to text when its similarity
+// reaches the threshold.
+func (m *FAQMatcher) Match(ctx context.Context, text string) (faqEntry, float64, bool, error) {
+	if m == nil || strings.TrimSpace(text) == "" {
+		return faqEntry{}, 0, false, nil
+	}
+	vectors, err := m.client.Embed(ctx, []string{text})
+	if err != nil {
+		return faqEntry{}, 0, false, fmt.Errorf("embed question: %w", err)
+	}
+	index, score := m.store.Nearest(vectors[0])
+	if index < 0 || score < m.threshold {
+		return faqEntry{}, score, false, nil
+	}
+	return m.entries[index], score, true, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// injectionPatterns catch the usual attempts to override the system prompt,
+// in Spanish and English.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget)\b.{0,30}\b(previous|prior|above|all)\b.{0,20}\b(instructions|rules|prompts?)\b`),
+	regexp.MustCompile(`(?i)\b(ignora|olvida|olvidate de)\b.{0,30}\b(instrucciones|reglas|indicaciones)\b`),
+	regexp.MustCompile(`(?i)\b(system prompt|prompt del sistema|developer mode|modo desarrollador|jailbreak)\b`),
+	regexp.MustCompile(`(?i)\b(you are now|ahora sos|ahora eres)\b.{0,40}\b(ai|ia|assistant|asistente|model|modelo)\b`),
+	regexp.MustCompile(`(?i)\b(reveal|show|print|mostra|muestra|revela)\b.{0,30}\b(your|tus|tu)\b.{0,20}\b(instructions|prompt|instrucciones)\b`),
+}
+
+const (
+	longInputTruncate = "truncate"
+	longInputReject   = "reject"
+
+	defaultLongInputNotice  = "Tu mensaje es muy largo, así que solo leímos la primera parte. Si falta algo importante, mandalo en un mensaje aparte."
+	defaultLongInputMessage = "Tu mensaje es muy largo para que lo podamos leer. ¿Nos lo podés resumir en unas líneas?"
+)
+
+// contentFilter runs cheap checks on customer text before it reaches the
+// model. Screen blocks keywords and injection attempts in what the customer
+// wrote or said; Limit truncates overly long input, including document
+// text, or rejects it when rejectLong is set.
+type contentFilter struct {
+	maxChars   int
+	rejectLong bool
+	keywords   []string
+}
+
+type filterVerdict struct {
+	Text    string
+	Blocked bool
+	TooLong bool
+	Reason  string
+}
+
+func (f *contentFilter) Screen(text string) filterVerdict {
+	folded := foldAccents(strings.ToLower(text))
+	for _, keyword := range f.keywords {
+		if strings.Contains(folded, keyword) {
+			return filterVerdict{Blocked: true, Reason: "keyword:" + keyword}
+		}
+	}
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(folded) {
+			return filterVerdict{Blocked: true, Reason: "prompt_injection"}
+		}
+	}
+	return filterVerdict{Text: text}
+}
+
+func (f *contentFilter) Limit(text string) filterVerdict {
+	if runes := []rune(text); f.maxChars > 0 && len(runes) > f.maxChars {
+		if f.rejectLong {
+			return filterVerdict{TooLong: true, Reason: "too_long"}
+		}
+		return filterVerdict{Text: string(runes[:f.maxChars]), Reason: "truncated"}
+	}
+	return filterVerdict{Text: text}
+}
+
+// loadBlockedKeywords merges the comma separated list with the file, which
+// holds one keyword per line and allows # comments. A missing file is an error
+// only when a path was given.
+func loadBlockedKeywords(list, path string) ([]string, error) {
+	var keywords []string
+	add := func(value string) {
+		if value = foldAccents(strings.ToLower(strings.TrimSpace(value))); value != "" {
+			keywords = append(keywords, value)
+		}
+	}
+	for _, item := range strings.Split(list, ",") {
+		add(item)
+	}
+
+	if path == "" {
+		return keywords, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("keyword file %s not found", path)
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		add(line)
+	}
+	return keywords, scanner.Err()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	finishStop          = "stop"
+	finishLength        = "length"
+	finishContentFilter = "content_filter"
+	finishToolCalls     = "tool_calls"
+
+	lengthNote     = "note"
+	lengthContinue = "continue"
+
+	// maxContinuations bounds how many extra requests a cut off reply may
+	// take with OPENAI_LENGTH_ACTION=continue.
+	maxContinuations = 2
+
+	truncatedReplyNote = "(La respuesta quedó cortada. Si necesitás más detalle, pedinos que sigamos.)"
+	continuePrompt     = "Continuá la respuesta exactamente donde quedó, sin repetir nada de lo anterior."
+)
+
+// errContentFilter means the provider withheld the reply. Asking again gets
+// the same answer, so it is neither retried nor sent to the fallback model.
+var errContentFilter = errors.New("reply stopped by the provider's content filter")
+
+// checkFinish turns finish reasons that leave no usable content into errors.
+func checkFinish(reason, content string) error {
+	switch {
+	case reason == finishContentFilter:
+		return errContentFilter
+	case strings.TrimSpace(content) != "":
+		return nil
+	case reason == finishLength:
+		return badResponse(fmt.Errorf("openai reply cut off before any content (finish_reason %s), raise OPENAI_MAX_TOKENS", reason))
+	default:
+		return badResponse(errors.New("openai returned empty content"))
+	}
+}
+
+// noteTruncated marks a reply that hit the token limit, so the customer knows
+// it is incomplete.
+func noteTruncated(reply string) string {
+	return strings.TrimSpace(reply) + "\n\n" + truncatedReplyNote
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+type freightRate struct {
+	Base     float64
+	PerKg    float64
+	PerCubic float64
+}
+
+type rateTable map[[2]string]freightRate
+
+type freightQuoteArgs struct {
+	Origin      string  `json:"origen"`
+	Destination string  `json:"destino"`
+	WeightKg    float64 `json:"peso_kg"`
+	VolumeM3    float64 `json:"volumen_m3"`
+}
+
+type freightQuote struct {
+	Origin      string  `json:"origen"`
+	Destination string  `json:"destino"`
+	WeightKg    float64 `json:"peso_kg"`
+	VolumeM3    float64 `json:"volumen_m3"`
+	PriceARS    float64 `json:"precio_ars"`
+}
+
+const freightToolParameters = `{
+	"type": "object",
+	"properties": {
+		"origen": {"type": "string", "description": "Ciudad de origen"},
+		"destino": {"type": "string", "description": "Ciudad de destino"},
+		"peso_kg": {"type": "number", "description": "Peso total de la carga en kilos"},
+		"volumen_m3": {"type": "number", "description": "Volumen total de la carga en metros cubicos"}
+	},
+	"required": ["origen", "destino", "peso_kg", "volumen_m3"]
+}`
+
+func freightTools(rates rateTable) toolRegistry {
+	if len(rates) == 0 {
+		return nil
+	}
+	return toolRegistry{
+		"calcular_flete": {
+			description: "Calcula el precio de un flete entre dos ciudades segun el tarifario de Fletes Ostrit.",
+			parameters:  json.RawMessage(freightToolParameters),
+			handler: func(ctx context.Context, arguments json.RawMessage) (any, error) {
+				var args freightQuoteArgs
+				if err := json.Unmarshal(arguments, &args); err != nil {
+					return nil, fmt.Errorf("argumentos invalidos: %w", err)
+				}
+				quote, err := rates.Quote(args)
+				if err == nil {
+					markQuoted(ctx)
+				}
+				return quote, err
+			},
+		},
+	}
+}
+
+type quoteGivenKey struct{}
+
+// withQuoteTracking reports whether calcular_flete priced a route while
+// answering, so only quotes get a follow-up.
+func withQuoteTracking(ctx context.Context) (context.Context, *atomic.Bool) {
+	quoted := &atomic.Bool{}
+	return context.WithValue(ctx, quoteGivenKey{}, quoted), quoted
+}
+
+func markQuoted(ctx context.Context) {
+	if quoted, ok := ctx.Value(quoteGivenKey{}).(*atomic.Bool); ok {
+		quoted.Store(true)
+	}
+}
+
+func (t rateTable) Quote(args freightQuoteArgs) (freightQuote, error) {
+	if args.WeightKg < 0 || args.VolumeM3 < 0 {
+		return freightQuote{}, errors.New("peso y volumen no pueden ser negativos")
+	}
+
+	rate, ok := t.lookup(args.Origin, args.Destination)
+	if !ok {
+		return freightQuote{}, fmt.Errorf("no hay tarifa para %s - %s, derivar a un asesor", args.Origin, args.Destination)
+	}
+
+	price := rate.Base + rate.PerKg*args.WeightKg + rate.PerCubic*args.VolumeM3
+	return freightQuote{
+		Origin:      args.Origin,
+		Destination: args.Destination,
+		WeightKg:    args.WeightKg,
+		VolumeM3:    args.VolumeM3,
+		PriceARS:    math.Round(price),
+	}, nil
+}
+
+func (t rateTable) lookup(origin, destination string) (freightRate, bool) {
+	from, to := normalizePlace(origin), normalizePlace(destination)
+	if rate, ok := t[[2]string{from, to}]; ok {
+		return rate, true
+	}
+	rate, ok := t[[2]string{to, from}]
+	return rate, ok
+}
+
+// loadRateTable reads a CSV with header origen,destino,base,por_kg,por_m3.
+// A missing file disables the quoting tool.
+func loadRateTable(path string) (rateTable, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+	if _, err := reader.Read(); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	table := rateTable{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 5 {
+			return nil, fmt.Errorf("row %q: expected 5 columns", strings.Join(record, ","))
+		}
+
+		var values [3]float64
+		for i := range values {
+			values[i], err = strconv.ParseFloat(strings.TrimSpace(record[i+2]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("route %s-%s: invalid number %q", record[0], record[1], record[i+2])
+			}
+		}
+		key := [2]string{normalizePlace(record[0]), normalizePlace(record[1])}
+		table[key] = freightRate{Base: values[0], PerKg: values[1], PerCubic: values[2]}
+	}
+	return table, nil
+}
+
+func normalizePlace(value string) string {
+	return strings.Join(strings.Fields(foldAccents(strings.ToLower(value))), " ")
+}
+
+var accentFolder = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n",
+	"Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U", "Ñ", "N",
+	"ã", "a", "õ", "o", "â", "a", "ê", "e", "ô", "o", "à", "a", "ç", "c",
+)
+
+func foldAccents(value string) string {
+	return accentFolder.Replace(value)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// FreightRequest is the structured form of what a customer asked for, as
+// understood so far. Empty fields are still unknown.
+type FreightRequest struct {
+	Origin      string  `json:"origin"`
+	Destination string  `json:"destination"`
+	Date        string  `json:"date"`
+	CargoType   string  `json:"cargo_type"`
+	WeightKg    float64 `json:"weight_kg"`
+	VolumeM3    float64 `json:"volume_m3"`
+}
+
+const freightExtractionPrompt = `Extrae los datos del pedido de flete de la conversacion.
+Responde solo con un objeto JSON con estas claves:
+- "origin": ciudad o direccion de origen
+- "destination": ciudad o direccion de destino
+- "date": fecha del viaje en formato AAAA-MM-DD si se puede, o como la dijo el cliente
+- "cargo_type": que se transporta (por ejemplo mudanza, electrodomesticos, pallets)
+- "weight_kg": peso total en kilos
+- "volume_m3": volumen total en metros cubicos
+Usa "" o 0 para lo que el cliente todavia no dijo. No inventes datos.`
+
+// Missing lists, in Spanish, the fields a quote still needs.
+func (r FreightRequest) Missing() []string {
+	var missing []string
+	if r.Origin == "" {
+		missing = append(missing, "origen")
+	}
+	if r.Destination == "" {
+		missing = append(missing, "destino")
+	}
+	if r.Date == "" {
+		missing = append(missing, "fecha")
+	}
+	if r.CargoType == "" {
+		missing = append(missing, "tipo de carga")
+	}
+	if r.WeightKg == 0 && r.VolumeM3 == 0 {
+		missing = append(missing, "peso o volumen")
+	}
+	return missing
+}
+
+// Empty reports whether nothing about a freight was mentioned yet.
+func (r FreightRequest) Empty() bool {
+	return r == FreightRequest{}
+}
+
+func (r FreightRequest) validate() error {
+	if r.WeightKg < 0 || r.VolumeM3 < 0 {
+		return fmt.Errorf("negative weight or volume in %+v", r)
+	}
+	return nil
+}
+
+func parseFreightRequest(content string) (FreightRequest, error) {
+	var req FreightRequest
+	if err := json.Unmarshal([]byte(content), &req); err != nil {
+		return FreightRequest{}, fmt.Errorf("decode freight request: %w", err)
+	}
+	req.Origin = strings.TrimSpace(req.Origin)
+	req.Destination = strings.TrimSpace(req.Destination)
+	req.Date = strings.TrimSpace(req.Date)
+	req.CargoType = strings.TrimSpace(req.CargoType)
+	return req, req.validate()
+}
+
+func freightFollowupMessage(missing []string) chatMessage {
+	return chatMessage{
+		Role:    "system",
+		Content: "Para cotizar el flete todavia falta: " + strings.Join(missing, ", ") + ". Si el cliente no lo dijo en este mensaje, pediselo de forma breve.",
+	}
+}
+
+type FreightExtractor interface {
+	ExtractFreightRequest(ctx context.Context, messages []chatMessage) (FreightRequest, error)
+}
+
+// newFreightExtractor returns nil unless FREIGHT_EXTRACTION is on. It needs
+// JSON mode, so only the OpenAI-compatible providers are supported.
+func newFreightExtractor(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) FreightExtractor {
+	if !cfg.FreightExtraction || cfg.DryRun {
+		return nil
+	}
+	if cfg.AIProvider == providerAzure {
+		return NewAzureClient(cfg, prompt, usage, logger)
+	}
+	return NewOpenAIClient(cfg, prompt, usage, logger)
+}
+
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+func (c *OpenAIClient) ExtractFreightRequest(ctx context.Context, messages []chatMessage) (FreightRequest, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		switch msg.Role {
+		case "user":
+			fmt.Fprintf(&transcript, "Cliente: %s\n", msg.Content)
+		case "assistant":
+			fmt.Fprintf(&transcript, "Asistente: %s\n", msg.Content)
+		}
+	}
+
+	temperature := 0.0
+	body, err := json.Marshal(adaptRequest(chatCompletionRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: freightExtractionPrompt},
+			{Role: "user", Content: transcript.String()},
+		},
+		Temperature:    &temperature,
+		ResponseFormat: &responseFormat{Type: "json_object"},
+	}))
+	if err != nil {
+		return FreightRequest{}, fmt.Errorf("encode request: %w", err)
+	}
+
+	var req FreightRequest
+	err = c.withRetry(ctx, func() error {
+		start := time.Now()
+		parsed, err := c.complete(ctx, body)
+		if err != nil {
+			return err
+		}
+		c.recordUsage(c.model, parsed.Usage, len(messages), time.Since(start))
+		req, err = parseFreightRequest(parsed.Choices[0].Message.Content)
+		return err
+	})
+	return req, err
+}
+
+const freightRequestSchema = `
+CREATE TABLE IF NOT EXISTS fletes_freight_requests (
+	chat_jid    TEXT PRIMARY KEY,
+	origin      TEXT    NOT NULL,
+	destination TEXT    NOT NULL,
+	date        TEXT    NOT NULL,
+	cargo_type  TEXT    NOT NULL,
+	weight_kg   REAL    NOT NULL,
+	volume_m3   REAL    NOT NULL,
+	complete    INTEGER NOT NULL,
+	updated_at  INTEGER NOT NULL
+);
+`
+
+// FreightRequestStore keeps the latest parsed request of every chat for
+// downstream automation.
+type FreightRequestStore struct {
+	db *sql.DB
+}
+
+func NewFreightRequestStore(db *sql.DB) (*FreightRequestStore, error) {
+	if _, err := db.Exec(freightRequestSchema); err != nil {
+		return nil, fmt.Errorf("create freight requests table: %w", err)
+	}
+	return &FreightRequestStore{db: db}, nil
+}
+
+func (s *FreightRequestStore) Save(ctx context.Context, chat string, req FreightRequest) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_freight_requests (chat_jid, origin, destination, date, cargo_type, weight_kg, volume_m3, complete, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chat_jid) DO UPDATE SET
+			origin = excluded.origin, destination = excluded.destination, date = excluded.date,
+			cargo_type = excluded.cargo_type, weight_kg = excluded.weight_kg, volume_m3 = excluded.volume_m3,
+			complete = excluded.complete, updated_at = excluded.updated_at`,
+		chat, req.Origin, req.Destination, req.Date, req.CargoType, req.WeightKg, req.VolumeM3,
+		len(req.Missing()) == 0, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("save freight request: %w", err)
+	}
+	return nil
+}
+
+// extractFreightRequest parses the conversation so far and stores the
+// result. It returns nil when extraction is off, fails or finds nothing.
+func (b *Bot) extractFreightRequest(ctx context.Context, chat string, messages []chatMessage, logger *slog.Logger) *FreightRequest {
+	extractor := b.current().freightExtractor
+	if extractor == nil {
+		return nil
+	}
+	req, err := extractor.ExtractFreightRequest(ctx, messages)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logger.Warn("freight request extraction failed", "error", err)
+		}
+		return nil
+	}
+	if req.Empty() {
+		return nil
+	}
+	logger.Debug("freight request parsed", "request", req, "missing", req.Missing())
+	if err := b.freightRequests.Save(ctx, chat, req); err != nil {
+		logger.Error("save freight request failed", "error", err)
+	}
+	return &req
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const defaultGreetingMaxWords = 4
+
+// greetingReplies answers trivial messages such as "hola" or "gracias!"
+// with a canned reply instead of a chat completion. A message matches when,
+// normalized, it is made only of trigger phrases and has at most maxWords
+// words, so "hola, cuanto sale un flete?" still goes to the model.
+type greetingReplies struct {
+	replies  map[string]string
+	longest  int
+	maxWords int
+}
+
+// parseGreetingReplies reads entries like
+// "gracias|muchas gracias=¡De nada! 🚚;hola|buenas=¡Hola! ¿En qué te ayudamos?".
+// Entries are separated by ";" since replies often contain commas.
+func parseGreetingReplies(key, value string, maxWords int) (greetingReplies, error) {
+	greetings := greetingReplies{maxWords: maxWords}
+	for _, item := range strings.Split(value, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		triggers, reply, ok := strings.Cut(item, "=")
+		reply = strings.TrimSpace(reply)
+		if !ok || reply == "" {
+			return greetingReplies{}, fmt.Errorf("%s: invalid entry %q, want trigger|trigger=reply", key, item)
+		}
+		for _, trigger := range strings.Split(triggers, "|") {
+			phrase := normalizeGreeting(trigger)
+			if phrase == "" {
+				return greetingReplies{}, fmt.Errorf("%s: empty trigger in %q", key, item)
+			}
+			if _, ok := greetings.replies[phrase]; ok {
+				return greetingReplies{}, fmt.Errorf("%s: trigger %q is listed twice", key, phrase)
+			}
+			if greetings.replies == nil {
+				greetings.replies = make(map[string]string)
+			}
+			greetings.replies[phrase] = reply
+			greetings.longest = max(greetings.longest, len(strings.Fields(phrase)))
+		}
+	}
+	return greetings, nil
+}
+
+// normalizeGreeting lowercases text, folds accents and turns punctuation and
+// emoji into spaces.
+func normalizeGreeting(text string) string {
+	text = foldAccents(strings.ToLower(text))
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// Match returns the reply for text, that of its first phrase when it
+// combines several ("hola, buen dia").
+func (g greetingReplies) Match(text string) (string, bool) {
+	if len(g.replies) == 0 {
+		return "", false
+	}
+	words := strings.Fields(normalizeGreeting(text))
+	if len(words) == 0 || len(words) > g.maxWords {
+		return "", false
+	}
+
+	var reply string
+	for len(words) > 0 {
+		matched := false
+		for n := min(g.longest, len(words)); n > 0; n-- {
+			if answer, ok := g.replies[strings.Join(words[:n], " ")]; ok {
+				if reply == "" {
+					reply = answer
+				}
+				words, matched = words[n:], true
+				break
+			}
+		}
+		if !matched {
+			return "", false
+		}
+	}
+	return reply, true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func (b *Bot) shouldReplyInGroup(evt *events.Message) bool {
+	if !b.respondInGroups {
+		return false
+	}
+	if !b.groupRequireMention {
+		return true
+	}
+
+	own := b.client.Store.ID
+	if own == nil {
+		return false
+	}
+
+	info := messageContextInfo(evt.Message)
+	if info == nil {
+		return false
+	}
+	for _, mentioned := range info.GetMentionedJID() {
+		if sameUser(mentioned, *own) {
+			return true
+		}
+	}
+	return info.GetStanzaID() != "" && sameUser(info.GetParticipant(), *own)
+}
+
+func messageContextInfo(msg *waProto.Message) *waProto.ContextInfo {
+	switch {
+	case msg == nil:
+		return nil
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	default:
+		return nil
+	}
+}
+
+func sameUser(value string, own types.JID) bool {
+	jid, err := types.ParseJID(value)
+	if err != nil {
+		return false
+	}
+	return jid.User == own.User && jid.Server == own.Server
+}
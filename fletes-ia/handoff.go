@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type HandoffStore struct {
+	db      *sql.DB
+	idleTTL time.Duration
+	now     func() time.Time
+}
+
+const handoffSchema = `
+CREATE TABLE IF NOT EXISTS fletes_handoff (
+	chat_jid      TEXT    PRIMARY KEY,
+	enabled_at    INTEGER NOT NULL,
+	last_activity INTEGER NOT NULL
+);
+`
+
+func NewHandoffStore(db *sql.DB, idleTTL time.Duration) (*HandoffStore, error) {
+	if _, err := db.Exec(handoffSchema); err != nil {
+		return nil, fmt.Errorf("create handoff table: %w", err)
+	}
+	return &HandoffStore{db: db, idleTTL: idleTTL, now: time.Now}, nil
+}
+
+func (s *HandoffStore) Enable(ctx context.Context, chat string) error {
+	now := s.now().Unix()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_handoff (chat_jid, enabled_at, last_activity) VALUES (?, ?, ?)
+		ON CONFLICT (chat_jid) DO UPDATE SET last_activity = excluded.last_activity`, chat, now, now)
+	if err != nil {
+		return fmt.Errorf("enable handoff: %w", err)
+	}
+	return nil
+}
+
+func (s *HandoffStore) Disable(ctx context.Context, chat string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM fletes_handoff WHERE chat_jid = ?`, chat); err != nil {
+		return fmt.Errorf("disable handoff: %w", err)
+	}
+	return nil
+}
+
+// Active reports whether chat is handled by a human. Every check counts as
+// activity, so the idle expiry only fires after a quiet period; an expired
+// handoff is removed and automatic replies resume.
+func (s *HandoffStore) Active(ctx context.Context, chat string) (bool, error) {
+	var lastActivity int64
+	err := s.db.QueryRowContext(ctx, `SELECT last_activity FROM fletes_handoff WHERE chat_jid = ?`, chat).Scan(&lastActivity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query handoff: %w", err)
+	}
+
+	now := s.now()
+	if s.idleTTL > 0 && now.Sub(time.Unix(lastActivity, 0)) > s.idleTTL {
+		return false, s.Disable(ctx, chat)
+	}
+
+	_, err = s.db.ExecContext(ctx, `UPDATE fletes_handoff SET last_activity = ? WHERE chat_jid = ?`, now.Unix(), chat)
+	if err != nil {
+		return true, fmt.Errorf("touch handoff: %w", err)
+	}
+	return true, nil
+}
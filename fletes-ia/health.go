@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// newHealthMux serves the probes, metrics and pairing QR for every account.
+// /readyz needs all of them connected, except those with WHATSAPP_DISABLED;
+// with several accounts /qr takes an ?account= parameter and, like the rest
+// of the process wide settings, QR_TOKEN comes from the first account.
+// POST /reply is only there when an account sets REPLY_API_TOKEN.
+func newHealthMux(runners []*accountRunner, metrics *Metrics) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		for _, runner := range runners {
+			if runner.cfg.WhatsAppDisabled {
+				continue
+			}
+			if !runner.client.IsConnected() || !runner.client.IsLoggedIn() {
+				http.Error(w, strings.TrimSpace("whatsapp not ready "+runner.name), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready\n"))
+	})
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/qr", qrHandler(runners, runners[0].cfg.QRToken, false))
+	mux.Handle("/qr.png", qrHandler(runners, runners[0].cfg.QRToken, true))
+	for _, runner := range runners {
+		if runner.web != nil {
+			mux.Handle("/reply", replyHandler(runners))
+			break
+		}
+	}
+	return mux
+}
+
+func runHTTPServer(ctx context.Context, addr string, handler http.Handler, logger *slog.Logger) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("http server shutdown failed", "error", err)
+		}
+	}()
+
+	logger.Info("http server listening", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("http server failed", "error", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ConversationStore struct {
+	db        *sql.DB
+	limit     int
+	maxTokens int
+}
+
+const conversationSchema = `
+CREATE TABLE IF NOT EXISTS fletes_conversation_messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_jid   TEXT    NOT NULL,
+	role       TEXT    NOT NULL,
+	content    TEXT    NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fletes_conversation_messages_chat_idx
+	ON fletes_conversation_messages (chat_jid, id);
+`
+
+func NewConversationStore(db *sql.DB, limit, maxTokens int) (*ConversationStore, error) {
+	if _, err := db.Exec(conversationSchema); err != nil {
+		return nil, fmt.Errorf("create conversation table: %w", err)
+	}
+	if _, err := db.Exec(summarySchema); err != nil {
+		return nil, fmt.Errorf("create summary table: %w", err)
+	}
+	return &ConversationStore{db: db, limit: limit, maxTokens: maxTokens}, nil
+}
+
+// Load returns the chat's recent messages, preceded by its summary as a
+// system message once older turns were summarized.
+func (s *ConversationStore) Load(ctx context.Context, chat string) ([]chatMessage, error) {
+	summary, err := s.Summary(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT role, content FROM (
+			SELECT id, role, content FROM fletes_conversation_messages
+			WHERE chat_jid = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC`, chat, s.limit)
+	if err != nil {
+		return nil, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []chatMessage
+	if summary != "" {
+		history = append(history, summaryMessage(summary))
+	}
+	for rows.Next() {
+		var msg chatMessage
+		if err := rows.Scan(&msg.Role, &msg.Content); err != nil {
+			return nil, fmt.Errorf("scan history: %w", err)
+		}
+		history = append(history, msg)
+	}
+	return history, rows.Err()
+}
+
+func (s *ConversationStore) Append(ctx context.Context, chat string, messages ...chatMessage) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin history tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	for _, msg := range messages {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO fletes_conversation_messages (chat_jid, role, content, created_at)
+			VALUES (?, ?, ?, ?)`, chat, msg.Role, msg.Content, now)
+		if err != nil {
+			return fmt.Errorf("insert history: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM fletes_conversation_messages
+		WHERE chat_jid = ? AND id NOT IN (
+			SELECT id FROM fletes_conversation_messages
+			WHERE chat_jid = ?
+			ORDER BY id DESC
+			LIMIT ?
+		)`, chat, chat, s.limit)
+	if err != nil {
+		return fmt.Errorf("trim history: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func (s *ConversationStore) Clear(ctx context.Context, chat string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM fletes_conversation_messages WHERE chat_jid = ?`, chat)
+	if err != nil {
+		return fmt.Errorf("clear history: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM fletes_conversation_summaries WHERE chat_jid = ?`, chat)
+	if err != nil {
+		return fmt.Errorf("clear summary: %w", err)
+	}
+	return nil
+}
+
+// estimateTokens approximates the token count of text as one token every
+// four characters, which is close enough for budgeting.
+func estimateTokens(text string) int {
+	return (len([]rune(text)) + 3) / 4
+}
+
+// Fit drops the oldest history until messages plus systemPrompt fit in the
+// configured token budget. System messages and the final (current) message
+// are always kept. It returns the trimmed slice and how many were dropped.
+func (s *ConversationStore) Fit(messages []chatMessage, systemPrompt string) ([]chatMessage, int) {
+	if s.maxTokens <= 0 || len(messages) == 0 {
+		return messages, 0
+	}
+
+	total := estimateTokens(systemPrompt)
+	for _, msg := range messages {
+		total += estimateTokens(msg.Content)
+	}
+
+	dropped := 0
+	kept := make([]chatMessage, 0, len(messages))
+	for i, msg := range messages {
+		if total > s.maxTokens && msg.Role != "system" && i < len(messages)-1 {
+			total -= estimateTokens(msg.Content)
+			dropped++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept, dropped
+}
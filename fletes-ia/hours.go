@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	minutesPerDay = 24 * 60
+
+	defaultAfterHoursMessage = "Gracias por escribirnos. En este momento estamos fuera del horario de atencion, te respondemos apenas abramos."
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	"dom": time.Sunday, "lun": time.Monday, "mar": time.Tuesday, "mie": time.Wednesday,
+	"jue": time.Thursday, "vie": time.Friday, "sab": time.Saturday,
+}
+
+type minuteRange struct {
+	start, end int
+}
+
+// BusinessHours holds opening windows per weekday in minutes since local
+// midnight. A nil *BusinessHours is always open.
+type BusinessHours struct {
+	spec    string
+	loc     *time.Location
+	windows [7][]minuteRange
+}
+
+// parseBusinessHours reads rules like "Mon-Fri 09:00-13:00,14:00-18:00; Sat 09:00-12:00".
+// A range ending before it starts (22:00-02:00) continues into the next day.
+func parseBusinessHours(spec string, loc *time.Location) (*BusinessHours, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+
+	hours := &BusinessHours{spec: spec, loc: loc}
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		dayPart, rangePart, ok := strings.Cut(rule, " ")
+		if !ok {
+			return nil, fmt.Errorf("business hours rule %q must be \"<days> <HH:MM-HH:MM>\"", rule)
+		}
+		days, err := parseWeekdays(dayPart)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range strings.Split(rangePart, ",") {
+			r, err := parseMinuteRange(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("business hours rule %q: %w", rule, err)
+			}
+			for _, day := range days {
+				hours.add(day, r)
+			}
+		}
+	}
+	return hours, nil
+}
+
+func (h *BusinessHours) add(day time.Weekday, r minuteRange) {
+	if r.end > r.start {
+		h.windows[day] = append(h.windows[day], r)
+		return
+	}
+	next := (day + 1) % 7
+	h.windows[day] = append(h.windows[day], minuteRange{start: r.start, end: minutesPerDay})
+	if r.end > 0 {
+		h.windows[next] = append(h.windows[next], minuteRange{start: 0, end: r.end})
+	}
+}
+
+func (h *BusinessHours) Open(t time.Time) bool {
+	if h == nil {
+		return true
+	}
+
+	local := t.In(h.loc)
+	minute := local.Hour()*60 + local.Minute()
+	for _, r := range h.windows[local.Weekday()] {
+		if minute >= r.start && minute < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *BusinessHours) String() string {
+	if h == nil {
+		return ""
+	}
+	return h.spec
+}
+
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, item := range strings.Split(value, ",") {
+		from, to, isRange := strings.Cut(strings.ToLower(strings.TrimSpace(item)), "-")
+		start, ok := weekdayNames[from]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", from)
+		}
+		if !isRange {
+			days = append(days, start)
+			continue
+		}
+		end, ok := weekdayNames[to]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", to)
+		}
+		for day := start; ; day = (day + 1) % 7 {
+			days = append(days, day)
+			if day == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseMinuteRange(value string) (minuteRange, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return minuteRange{}, fmt.Errorf("invalid range %q", value)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return minuteRange{}, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return minuteRange{}, err
+	}
+	if start == end {
+		return minuteRange{}, fmt.Errorf("empty range %q", value)
+	}
+	return minuteRange{start: start, end: end}, nil
+}
+
+func parseClock(value string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(value), ":")
+	hour, errH := strconv.Atoi(hh)
+	minute, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || minute < 0 || minute > 59 || hour < 0 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// Overlap returns the first weekday on which h and other share a minute.
+func (h *BusinessHours) Overlap(other *BusinessHours) (time.Weekday, bool) {
+	if h == nil || other == nil {
+		return 0, false
+	}
+	for day := range h.windows {
+		for _, a := range h.windows[day] {
+			for _, b := range other.windows[day] {
+				if a.start < b.end && b.start < a.end {
+					return time.Weekday(day), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBusinessHours(t *testing.T) {
+	buenosAires := time.FixedZone("ART", -3*60*60)
+	for _, tc := range []struct {
+		name string
+		spec string
+		loc  *time.Location
+		open map[string]bool
+	}{
+		{
+			name: "several ranges per day",
+			spec: "Mon-Fri 09:00-13:00,14:00-18:00; Sat 09:00-12:00",
+			loc:  buenosAires,
+			open: map[string]bool{
+				"2026-10-12T08:59:00-03:00": false, // Monday before opening
+				"2026-10-12T09:00:00-03:00": true,
+				"2026-10-12T13:30:00-03:00": false, // lunch break
+				"2026-10-12T17:59:00-03:00": true,
+				"2026-10-12T18:00:00-03:00": false, // end is exclusive
+				"2026-10-17T11:00:00-03:00": true,  // Saturday
+				"2026-10-17T12:30:00-03:00": false,
+				"2026-10-18T10:00:00-03:00": false, // Sunday
+				"2026-10-12T15:00:00Z":      true,  // 12:00 in Buenos Aires
+			},
+		},
+		{
+			name: "overnight range",
+			spec: "Fri-Sat 22:00-02:00",
+			loc:  buenosAires,
+			open: map[string]bool{
+				"2026-10-16T21:59:00-03:00": false,
+				"2026-10-16T23:00:00-03:00": true, // Friday night
+				"2026-10-17T01:59:00-03:00": true, // carried into Saturday
+				"2026-10-17T02:00:00-03:00": false,
+				"2026-10-18T01:00:00-03:00": true, // Saturday night into Sunday
+				"2026-10-18T23:00:00-03:00": false,
+			},
+		},
+		{
+			name: "weekday range wrapping the week, spanish names",
+			spec: "sab-lun 10:00-24:00",
+			loc:  buenosAires,
+			open: map[string]bool{
+				"2026-10-17T23:59:00-03:00": true,  // Saturday
+				"2026-10-18T10:00:00-03:00": true,  // Sunday
+				"2026-10-19T10:00:00-03:00": true,  // Monday
+				"2026-10-20T10:00:00-03:00": false, // Tuesday
+			},
+		},
+	} {
+		hours, err := parseBusinessHours(tc.spec, tc.loc)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for at, want := range tc.open {
+			ts, err := time.Parse(time.RFC3339, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hours.Open(ts); got != want {
+				t.Errorf("%s: Open(%s) = %v, want %v", tc.name, at, got, want)
+			}
+		}
+	}
+
+	// Hours follow the local clock across a DST change.
+	if newYork, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Logf("no tzdata, skipping the DST case: %v", err)
+	} else {
+		hours, err := parseBusinessHours("Mon-Fri 09:00-18:00", newYork)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for at, want := range map[string]bool{
+			"2026-03-06T14:00:00Z": true,  // Friday 09:00 EST
+			"2026-03-06T22:30:00Z": true,  // Friday 17:30 EST
+			"2026-03-09T13:00:00Z": true,  // Monday 09:00 EDT
+			"2026-03-09T12:30:00Z": false, // Monday 08:30 EDT, open at this UTC time before the change
+			"2026-03-09T22:30:00Z": false, // Monday 18:30 EDT
+		} {
+			ts, _ := time.Parse(time.RFC3339, at)
+			if got := hours.Open(ts); got != want {
+				t.Errorf("DST: Open(%s) = %v, want %v", at, got, want)
+			}
+		}
+	}
+
+	if hours, err := parseBusinessHours("  ", buenosAires); err != nil || hours != nil || !hours.Open(time.Now()) {
+		t.Errorf("empty spec = %v, %v, want nil hours that are always open", hours, err)
+	}
+	for _, spec := range []string{"Mon", "Xyz 09:00-18:00", "Mon 9-18", "Mon 09:00-25:00", "Mon 09:60-10:00", "Mon 09:00-09:00", "Mon-Fri 09:00"} {
+		if _, err := parseBusinessHours(spec, buenosAires); err == nil {
+			t.Errorf("parseBusinessHours(%q) succeeded, want an error", spec)
+		}
+	}
+}
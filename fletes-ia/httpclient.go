@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// newHTTPClient returns a client that goes through proxyURL when set and
+// otherwise honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+func newHTTPClient(timeout time.Duration, proxyURL *url.URL) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// parseHeaders reads comma separated Name:Value pairs, e.g.
+// "X-Gateway-Key:abc,api-key:xyz".
+func parseHeaders(key, value string) (http.Header, error) {
+	if value == "" {
+		return nil, nil
+	}
+	headers := http.Header{}
+	for _, pair := range strings.Split(value, ",") {
+		name, val, ok := strings.Cut(pair, ":")
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("%s: expected Name:Value pairs separated by commas, got %q", key, strings.TrimSpace(pair))
+		}
+		headers.Add(name, val)
+	}
+	return headers, nil
+}
+
+func parseProxyURL(key, value string) (*url.URL, error) {
+	if value == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return nil, fmt.Errorf("%s must be an http, https or socks5 URL, got %q", key, value)
+	}
+	return u, nil
+}
+
+// hasAuthHeader reports whether headers already authenticate the request,
+// as Azure's api-key or a gateway's own Authorization do.
+func hasAuthHeader(headers http.Header) bool {
+	return headers.Get("Authorization") != "" || headers.Get("Api-Key") != ""
+}
+
+// hasOpenAIAuth reports whether OpenAI requests can be authenticated, with
+// OPENAI_API_KEY or an auth header in OPENAI_EXTRA_HEADERS.
+func (cfg Config) hasOpenAIAuth() bool {
+	return cfg.OpenAIKey != "" || hasAuthHeader(cfg.OpenAIExtraHeaders)
+}
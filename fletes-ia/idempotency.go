@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+type idempotencyKey struct{}
+
+// withIdempotencyKey marks requests made with the returned context as part
+// of one logical message, identified by key.
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// setIdempotencyKey derives the Idempotency-Key header from the message key
+// in ctx and the request itself. Retries send the same body and so the same
+// key, while the other requests of the message (tool rounds, continuations,
+// the fallback model) get keys of their own.
+func setIdempotencyKey(ctx context.Context, headers http.Header, path string, body []byte) {
+	key, ok := ctx.Value(idempotencyKey{}).(string)
+	if !ok || key == "" {
+		return
+	}
+	sum := sha256.New()
+	sum.Write([]byte(key))
+	sum.Write([]byte{0})
+	sum.Write([]byte(path))
+	sum.Write([]byte{0})
+	sum.Write(body)
+	headers.Set(idempotencyHeader, hex.EncodeToString(sum.Sum(nil)))
+}
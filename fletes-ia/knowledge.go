@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	scoringKeyword    = "keyword"
+	scoringEmbeddings = "embeddings"
+)
+
+var knowledgeExtensions = map[string]bool{".txt": true, ".md": true, ".csv": true}
+
+type knowledgeChunk struct {
+	Source string
+	Text   string
+	terms  map[string]int
+	vector []float64
+}
+
+// KnowledgeBase holds the FAQ, price lists and other reference files in
+// KNOWLEDGE_DIR, split into chunks. Search picks the chunks most related to
+// a message so they can be given to the model as reference material.
+type KnowledgeBase struct {
+	chunks   []knowledgeChunk
+	idf      map[string]float64
+	topK     int
+	embedder Embedder
+}
+
+// loadKnowledge reads every .txt, .md and .csv file under dir. A missing
+// directory disables the knowledge base.
+func loadKnowledge(dir string, chunkChars, topK int) (*KnowledgeBase, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	kb := &KnowledgeBase{topK: topK}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !knowledgeExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		source, _ := filepath.Rel(dir, path)
+		for _, text := range chunkText(string(data), chunkChars) {
+			kb.chunks = append(kb.chunks, knowledgeChunk{Source: source, Text: text, terms: termCounts(text)})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(kb.chunks) == 0 {
+		return nil, nil
+	}
+
+	docs := map[string]int{}
+	for _, chunk := range kb.chunks {
+		for term := range chunk.terms {
+			docs[term]++
+		}
+	}
+	kb.idf = make(map[string]float64, len(docs))
+	for term, n := range docs {
+		kb.idf[term] = math.Log(1 + float64(len(kb.chunks))/float64(n))
+	}
+	return kb, nil
+}
+
+// chunkText splits text at blank lines and packs paragraphs into chunks of
+// at most size characters. Longer paragraphs are cut at a space.
+func chunkText(text string, size int) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		for _, piece := range splitRunes(paragraph, size) {
+			if current.Len() > 0 && len([]rune(current.String()))+len([]rune(piece))+2 > size {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			current.WriteString(piece)
+		}
+	}
+	flush()
+	return chunks
+}
+
+func splitRunes(text string, size int) []string {
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > size {
+		cut := size
+		for i := size; i > size/2; i-- {
+			if unicode.IsSpace(runes[i]) {
+				cut = i
+				break
+			}
+		}
+		pieces = append(pieces, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		pieces = append(pieces, string(runes))
+	}
+	return pieces
+}
+
+var knowledgeStopwords = map[string]bool{
+	"que": true, "con": true, "por": true, "para": true, "los": true, "las": true, "del": true,
+	"una": true, "uno": true, "como": true, "mas": true, "pero": true, "sus": true, "hay": true,
+	"esta": true, "este": true, "eso": true, "esto": true, "son": true, "hola": true, "quiero": true,
+	"necesito": true, "tienen": true, "cuanto": true, "sale": true, "the": true, "and": true,
+}
+
+var accentReplacer = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// termCounts lowercases text, drops accents, stopwords and words shorter
+// than three letters, and counts the rest.
+func termCounts(text string) map[string]int {
+	counts := map[string]int{}
+	words := strings.FieldsFunc(accentReplacer.Replace(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if len([]rune(word)) < 3 || knowledgeStopwords[word] {
+			continue
+		}
+		counts[word]++
+	}
+	return counts
+}
+
+// UseEmbeddings switches Search to cosine similarity, embedding every chunk
+// up front.
+func (kb *KnowledgeBase) UseEmbeddings(ctx context.Context, client *EmbeddingsClient) error {
+	texts := make([]string, len(kb.chunks))
+	for i, chunk := range kb.chunks {
+		texts[i] = chunk.Text
+	}
+	vectors, err := client.EmbedStored(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embed knowledge chunks: %w", err)
+	}
+	for i, vector := range vectors {
+		kb.chunks[i].vector = vector
+	}
+	kb.embedder = client
+	return nil
+}
+
+// Search returns up to topK chunks related to query, best first. If the
+// query can't be embedded it falls back to keyword scoring and returns the
+// error alongside the results.
+func (kb *KnowledgeBase) Search(ctx context.Context, query string) ([]knowledgeChunk, error) {
+	if kb == nil || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+
+	var err error
+	scores := make([]float64, len(kb.chunks))
+	if kb.embedder != nil {
+		var vectors [][]float64
+		vectors, err = kb.embedder.Embed(ctx, []string{query})
+		if err == nil {
+			for i, chunk := range kb.chunks {
+				scores[i] = cosineSimilarity(vectors[0], chunk.vector)
+			}
+			return kb.top(scores), nil
+		}
+		err = fmt.Errorf("embed query: %w", err)
+	}
+
+	terms := termCounts(query)
+	for i, chunk := range kb.chunks {
+		for term := range terms {
+			if n := chunk.terms[term]; n > 0 {
+				scores[i] += kb.idf[term] * (1 + math.Log(float64(n)))
+			}
+		}
+	}
+	return kb.top(scores), err
+}
+
+func (kb *KnowledgeBase) top(scores []float64) []knowledgeChunk {
+	order := make([]int, 0, len(scores))
+	for i, score := range scores {
+		if score > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > kb.topK {
+		order = order[:kb.topK]
+	}
+
+	chunks := make([]knowledgeChunk, len(order))
+	for i, index := range order {
+		chunks[i] = kb.chunks[index]
+	}
+	return chunks
+}
+
+func knowledgeMessage(chunks []knowledgeChunk) chatMessage {
+	var b strings.Builder
+	b.WriteString("Informacion de referencia de la empresa. Usala para responder si es relevante y no inventes datos que no esten aca.")
+	for _, chunk := range chunks {
+		fmt.Fprintf(&b, "\n\n[%s]\n%s", chunk.Source, chunk.Text)
+	}
+	return chatMessage{Role: "system", Content: b.String()}
+}
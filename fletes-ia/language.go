@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+const defaultLanguage = "es"
+
+var languageNames = map[string]string{
+	"es": "espanol",
+	"en": "ingles",
+	"pt": "portugues",
+}
+
+var languageWords = map[string][]string{
+	"es": {"hola", "que", "el", "la", "los", "las", "por", "para", "necesito", "quiero", "cuanto", "cuesta", "gracias", "buenas", "buenos", "dias", "tardes", "envio", "hasta", "desde", "una", "es", "y", "con", "mi", "donde", "puedo", "usted", "como"},
+	"en": {"hello", "hi", "the", "i", "need", "want", "how", "much", "does", "cost", "is", "to", "from", "please", "thanks", "thank", "you", "my", "can", "what", "where", "and", "with", "shipping", "truck"},
+	"pt": {"ola", "oi", "voce", "nao", "obrigado", "obrigada", "preciso", "quero", "quanto", "custa", "um", "uma", "para", "do", "da", "dos", "com", "meu", "minha", "bom", "dia", "tarde", "onde", "posso", "frete", "e", "como"},
+}
+
+var languageHints = map[string]string{
+	"es": "ñ¿¡",
+	"pt": "ãõç",
+}
+
+// detectLanguage guesses whether text is Spanish, English or Portuguese by
+// counting common words. ok is false when the text is too short or the top
+// two scores tie.
+func detectLanguage(text string) (lang string, ok bool) {
+	lower := strings.ToLower(text)
+	scores := make(map[string]int, len(languageWords))
+	for lang, hints := range languageHints {
+		if strings.ContainsAny(lower, hints) {
+			scores[lang] += 2
+		}
+	}
+
+	words := strings.FieldsFunc(foldAccents(lower), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, word := range words {
+		for lang, known := range languageWords {
+			for _, candidate := range known {
+				if word == candidate {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestScore, second := "", 0, 0
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, second = lang, score, bestScore
+		case score > second:
+			second = score
+		}
+	}
+	if bestScore < 2 || bestScore == second {
+		return defaultLanguage, false
+	}
+	return best, true
+}
+
+// parseLanguagePrompts reads a full system prompt per detected language from
+// SYSTEM_PROMPT_EN and SYSTEM_PROMPT_PT. The default language keeps
+// AI_SYSTEM_PROMPT, and languages without one get AI_SYSTEM_PROMPT plus
+// languageInstruction.
+func parseLanguagePrompts(value func(key string) string, multilingual bool) (map[string]string, error) {
+	var prompts map[string]string
+	for lang := range languageNames {
+		if lang == defaultLanguage {
+			continue
+		}
+		key := "SYSTEM_PROMPT_" + strings.ToUpper(lang)
+		text := strings.TrimSpace(value(key))
+		if text == "" {
+			continue
+		}
+		if !multilingual {
+			return nil, errors.New(key + " needs MULTILINGUAL=true")
+		}
+		if err := validatePromptTemplate(key, text); err != nil {
+			return nil, err
+		}
+		if prompts == nil {
+			prompts = make(map[string]string)
+		}
+		prompts[lang] = text
+	}
+	return prompts, nil
+}
+
+func languageInstruction(lang string) chatMessage {
+	name, ok := languageNames[lang]
+	if !ok {
+		name = languageNames[defaultLanguage]
+	}
+	return chatMessage{
+		Role:    "system",
+		Content: "Responde en " + name + ", el idioma que usa el cliente.",
+	}
+}
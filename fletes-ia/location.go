@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+type depotLocation struct {
+	Latitude  float64
+	Longitude float64
+	Name      string
+	Address   string
+}
+
+// parseDepotLocation returns nil when neither coordinate is set.
+func parseDepotLocation(lat, lon, name, address string) (*depotLocation, error) {
+	if lat == "" && lon == "" {
+		return nil, nil
+	}
+	if lat == "" || lon == "" {
+		return nil, errors.New("DEPOT_LAT and DEPOT_LON must be set together")
+	}
+
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return nil, errors.New("DEPOT_LAT must be a latitude between -90 and 90")
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return nil, errors.New("DEPOT_LON must be a longitude between -180 and 180")
+	}
+	return &depotLocation{Latitude: latitude, Longitude: longitude, Name: name, Address: address}, nil
+}
+
+func (d *depotLocation) Message() *waProto.Message {
+	loc := &waProto.LocationMessage{
+		DegreesLatitude:  proto.Float64(d.Latitude),
+		DegreesLongitude: proto.Float64(d.Longitude),
+	}
+	if d.Name != "" {
+		loc.Name = proto.String(d.Name)
+	}
+	if d.Address != "" {
+		loc.Address = proto.String(d.Address)
+	}
+	return &waProto.Message{LocationMessage: loc}
+}
+
+func (b *Bot) sendLocation(ctx context.Context, chat types.JID) bool {
+	if b.depot == nil {
+		return false
+	}
+	return b.sendMessage(ctx, chat, b.depot.Message())
+}
+
+type locationRequestKey struct{}
+
+// withLocationRequest lets the enviar_ubicacion tool ask for the depot pin
+// to be sent once the text reply is out.
+func withLocationRequest(ctx context.Context) (context.Context, *atomic.Bool) {
+	requested := &atomic.Bool{}
+	return context.WithValue(ctx, locationRequestKey{}, requested), requested
+}
+
+func requestLocation(ctx context.Context) bool {
+	requested, ok := ctx.Value(locationRequestKey{}).(*atomic.Bool)
+	if !ok {
+		return false
+	}
+	requested.Store(true)
+	return true
+}
+
+func depotTools(depot *depotLocation) toolRegistry {
+	if depot == nil {
+		return nil
+	}
+	return toolRegistry{
+		"enviar_ubicacion": {
+			description: "Envia al cliente la ubicacion del deposito de Fletes Ostrit como pin de WhatsApp. Usala cuando pregunte donde estamos o como llegar.",
+			parameters:  json.RawMessage(`{"type": "object", "properties": {}}`),
+			handler: func(ctx context.Context, arguments json.RawMessage) (any, error) {
+				if !requestLocation(ctx) {
+					return nil, errors.New("no se puede enviar la ubicacion en esta conversacion")
+				}
+				return map[string]string{
+					"estado":    "la ubicacion se envia despues de tu respuesta",
+					"nombre":    depot.Name,
+					"direccion": depot.Address,
+				}, nil
+			},
+		},
+	}
+}
@@ -1,158 +1,994 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
-	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"go.mau.fi/whatsmeow"
 	waProto "go.mau.fi/whatsmeow/binary/proto"
-	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
-	waLog "go.mau.fi/whatsmeow/util/log"
 	"google.golang.org/protobuf/proto"
 	_ "modernc.org/sqlite"
 )
 
 type Config struct {
-	OpenAIKey      string
-	OpenAIModel    string
-	OpenAIBaseURL  string
-	OpenAITimeout  time.Duration
-	SystemPrompt   string
-	WhatsAppDBPath string
+	OpenAIKey             string
+	OpenAIModel           string
+	OpenAIFallbackModel   string
+	OpenAIBaseURL         string
+	OpenAITimeout         time.Duration
+	MessageTimeout        time.Duration
+	OpenAIRetries         int
+	OpenAIStream          bool
+	StreamEdits           bool
+	LengthAction          string
+	TranscribeModel       string
+	OpenAIPricing         map[string]modelPrice
+	EnableVision          bool
+	VisionModel           string
+	VisionPrompt          string
+	RateLimitPerMinute    int
+	RateLimitNotify       bool
+	ContactAllowlist      contactSet
+	ContactBlocklist      contactSet
+	TypingIndicator       bool
+	MarkRead              bool
+	RespondInGroups       bool
+	GroupRequireMention   bool
+	QuoteOriginal         bool
+	LogFormat             string
+	LogLevel              slog.Level
+	SystemPrompt          string
+	SystemPromptFile      string
+	TimedPrompts          timedPrompts
+	WhatsAppDBPath        string
+	WhatsAppDisabled      bool
+	ShutdownTimeout       time.Duration
+	DedupCacheSize        int
+	DedupTTL              time.Duration
+	OutboundDedupWindow   time.Duration
+	HistoryLimit          int
+	HistorySummary        summaryPolicy
+	HandoffIdleTimeout    time.Duration
+	HealthAddr            string
+	ReplyAPIToken         string
+	QRToken               string
+	BusinessHours         *BusinessHours
+	AfterHoursMessage     string
+	FreightRates          rateTable
+	AIProvider            string
+	AnthropicKey          string
+	AnthropicModel        string
+	AnthropicBaseURL      string
+	OllamaModel           string
+	OllamaBaseURL         string
+	MaxMessageChars       int
+	Multilingual          bool
+	LanguagePrompts       map[string]string
+	TranscriptPath        string
+	Temperature           float64
+	MaxTokens             int
+	ChatQueueSize         int
+	MaxDocumentBytes      int64
+	DryRun                bool
+	Debounce              time.Duration
+	MaxMediaBytes         int64
+	MediaTypes            []string
+	ReplyTypes            replyTypeSet
+	GreetingReplies       greetingReplies
+	ReplyFilters          replyFilters
+	SendRatePerSecond     float64
+	Admins                contactSet
+	AdminNotifyJID        string
+	AdminNotifyCooldown   time.Duration
+	ErrorMessages         errorMessages
+	ReactionAck           string
+	BlockedKeywords       []string
+	MaxInputChars         int
+	LongInputMode         string
+	LongInputMessage      string
+	LongInputNotice       string
+	BlockedReply          string
+	WebhookURL            string
+	WebhookSecret         string
+	MaxContextTokens      int
+	ChatPromptsFile       string
+	FollowupDelay         time.Duration
+	FollowupMessage       string
+	CustomersPath         string
+	Depot                 *depotLocation
+	ReplyCacheTTL         time.Duration
+	ReplyCacheSize        int
+	WelcomeMessage        string
+	BreakerThreshold      int
+	BreakerCooldown       time.Duration
+	SlowReplyThreshold    time.Duration
+	SlowReplyMessage      string
+	StartupHealthcheck    bool
+	ContextMetadata       bool
+	Location              *time.Location
+	MaintenanceMode       bool
+	MaintenanceMessage    string
+	MessageLog            bool
+	BroadcastDays         int
+	ExportMaxBytes        int
+	OpenAIExtraHeaders    http.Header
+	OpenAIProxy           *url.URL
+	AzureKey              string
+	AzureEndpoint         string
+	AzureDeployment       string
+	AzureAPIVersion       string
+	MaxConcurrentRequests int
+	ConcurrencyWait       time.Duration
+	ReplyDelay            replyDelay
+	KnowledgeDir          string
+	KnowledgeTopK         int
+	KnowledgeChunkChars   int
+	KnowledgeScoring      string
+	EmbeddingsModel       string
+	ModerationModel       string
+	Moderation            moderationPolicy
+	EmbeddingsCachePath   string
+	FAQPath               string
+	FAQThreshold          float64
+	IgnoreImageCaptions   bool
+	FreightExtraction     bool
+	PriceSheetPath        string
+	PriceSheetCaption     string
+	OptOutKeywords        keywordSet
+	OptInKeywords         keywordSet
+	OptOutMessage         string
+	OptInMessage          string
+
+	// configKeys lists the variables parseConfig consulted, for logConfigSources.
+	configKeys []string
+	// fileKeys lists the variables set by CONFIG_FILE.
+	fileKeys map[string]bool
 }
 
 type OpenAIClient struct {
-	apiKey       string
-	baseURL      string
-	model        string
-	httpClient   *http.Client
-	systemPrompt string
+	baseURL  string
+	model    string
+	provider string
+	// query is appended to every request URL, e.g. Azure's api-version.
+	query           string
+	headers         http.Header
+	httpClient      *http.Client
+	logger          *slog.Logger
+	prompt          *promptSource
+	maxRetries      int
+	stream          bool
+	transcribeModel string
+	embeddingsModel string
+	moderationModel string
+	usage           *UsageTracker
+	visionModel     string
+	visionPrompt    string
+	fallbackModel   string
+	tools           toolRegistry
+	temperature     float64
+	maxTokens       int
+	lengthAction    string
+}
+
+type Bot struct {
+	log                 *slog.Logger
+	client              *whatsmeow.Client
+	usage               *UsageTracker
+	history             *ConversationStore
+	summaries           summaryPolicy
+	handoff             *HandoffStore
+	limiter             *RateLimiter
+	allowlist           contactSet
+	blocklist           contactSet
+	rateLimitNotify     bool
+	seen                *seenCache
+	sent                *seenCache
+	inProgress          inProgressReplies
+	respondInGroups     bool
+	groupRequireMention bool
+	quoteOriginal       bool
+	hours               *BusinessHours
+	messageTimeout      time.Duration
+	metrics             *Metrics
+	maxMessageChars     int
+	transcripts         *TranscriptWriter
+	maxDocumentBytes    int64
+	media               mediaPolicy
+	replyTypes          replyTypeSet
+	sendThrottle        *sendThrottle
+	admins              contactSet
+	reactionAck         string
+	filter              *contentFilter
+	longInputMessage    string
+	longInputNotice     string
+	webhook             *WebhookNotifier
+	prompt              *promptSource
+	chatPrompts         *SystemPromptStore
+	customers           customerDB
+	followups           *Scheduler
+	depot               *depotLocation
+	replyCache          *replyCache
+	contacts            *ContactStore
+	location            *time.Location
+	maintenance         *maintenanceMode
+	messageLog          *MessageLog
+	broadcasts          *broadcasts
+	broadcastDays       int
+	exportMaxBytes      int
+	requests            *requestLimiter
+	polls               *PollStore
+	knowledge           *KnowledgeBase
+	faq                 *FAQMatcher
+	freightRequests     *FreightRequestStore
+	priceSheetPath      string
+	priceSheetCaption   string
+	settingsMu          sync.RWMutex
+	settings            botSettings
+	optOuts             *OptOutStore
+	optOutKeywords      keywordSet
+	optInKeywords       keywordSet
+	optOutMessage       string
+	optInMessage        string
+	sender              MessageSender
 }
 
 type chatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	ToolCalls  []toolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+	Parts      []contentPart `json:"-"`
 }
 
 type chatCompletionRequest struct {
-	Model       string        `json:"model"`
-	Messages    []chatMessage `json:"messages"`
-	Temperature float64       `json:"temperature,omitempty"`
+	Model               string           `json:"model"`
+	Messages            []chatMessage    `json:"messages"`
+	Temperature         *float64         `json:"temperature,omitempty"`
+	MaxTokens           int              `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int              `json:"max_completion_tokens,omitempty"`
+	Tools               []toolDefinition `json:"tools,omitempty"`
+	Stream              bool             `json:"stream,omitempty"`
+	StreamOptions       *streamOptions   `json:"stream_options,omitempty"`
+	ResponseFormat      *responseFormat  `json:"response_format,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type chatCompletionResponse struct {
 	Choices []struct {
-		Message chatMessage `json:"message"`
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
 	} `json:"choices"`
+	Usage tokenUsage `json:"usage"`
 }
 
 func main() {
-	if err := loadDotEnv(".env"); err != nil {
+	logout := flag.Bool("logout", false, "unpair from WhatsApp, delete the session and exit")
+	dbPathFlag := flag.String("dbpath", "", "WhatsApp session database (overrides WHATSAPP_DB_PATH)")
+	flag.Parse()
+
+	dotenv, err := loadDotEnv(".env")
+	if err != nil {
 		log.Fatalf("load .env: %v", err)
 	}
+	if *dbPathFlag != "" {
+		os.Setenv("WHATSAPP_DB_PATH", *dbPathFlag)
+	}
 
-	cfg, err := loadConfig()
-	if err != nil {
-		log.Fatal(err)
+	if *logout {
+		dbPath := strings.TrimSpace(os.Getenv("WHATSAPP_DB_PATH"))
+		if dbPath == "" {
+			dbPath = defaultWhatsAppDBPath
+		}
+		if err := logoutSession(dbPath, newLogger(os.Stdout, "text", slog.LevelInfo)); err != nil {
+			log.Fatalf("logout: %v", err)
+		}
+		return
 	}
 
-	if err := os.MkdirAll(filepath.Dir(cfg.WhatsAppDBPath), 0o755); err != nil {
-		log.Fatalf("create data dir: %v", err)
+	accounts, err := loadAccounts()
+	if err != nil {
+		log.Fatal(err)
 	}
+	// Logging, HEALTH_ADDR and the shutdown timeout are process wide and
+	// come from the first account.
+	cfg := accounts[0].cfg
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	waLogger := waLog.Stdout("WA", "INFO", true)
-	dbLogger := waLog.Stdout("DB", "ERROR", true)
+	logger := newLogger(os.Stdout, cfg.LogFormat, cfg.LogLevel)
+	logConfigSources(logger, cfg.configKeys, dotenv, cfg.fileKeys)
 
-	dbPath := filepath.ToSlash(cfg.WhatsAppDBPath)
-	dsn := fmt.Sprintf("file:%s?_foreign_keys=on", dbPath)
-	container, err := sqlstore.New("sqlite", dsn, dbLogger)
-	if err != nil {
-		log.Fatalf("init store: %v", err)
+	usage := NewUsageTracker(cfg.OpenAIPricing)
+	metrics := NewMetrics()
+
+	runners := make([]*accountRunner, 0, len(accounts))
+	for _, account := range accounts {
+		runner, err := newAccountRunner(ctx, account, usage, metrics, logger)
+		if err != nil {
+			log.Fatal(accountError(account.name, err))
+		}
+		defer runner.Close()
+		runners = append(runners, runner)
+	}
+	if len(runners) > 1 {
+		logger.Info("serving multiple accounts", "count", len(runners))
+	}
+
+	// In-flight replies run on a context that keeps ctx's values but not its
+	// cancellation, so a shutdown signal lets them finish; cancelWork aborts
+	// whatever is left once SHUTDOWN_TIMEOUT runs out.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	var inflight sync.WaitGroup
+
+	go watchReload(ctx, logger, runners, dotenv)
+
+	if cfg.HealthAddr != "" {
+		go runHTTPServer(ctx, cfg.HealthAddr, newHealthMux(runners, metrics), logger)
+	}
+
+	for _, runner := range runners {
+		if err := runner.Start(ctx, workCtx, &inflight); err != nil {
+			log.Fatal(accountError(runner.name, err))
+		}
+	}
+
+	<-ctx.Done()
+	logger.Info("shutting down, waiting for in-flight replies", "timeout", cfg.ShutdownTimeout)
+	if !waitTimeout(&inflight, cfg.ShutdownTimeout) {
+		logger.Warn("shutdown timeout reached, aborting in-flight replies")
+	}
+	cancelWork()
+}
+
+func accountError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("account %s: %w", name, err)
+}
+
+// aborted reports whether err comes from ctx being cancelled, which only
+// happens when a shutdown outlasts SHUTDOWN_TIMEOUT, rather than from a real
+// failure.
+func aborted(ctx context.Context, err error) bool {
+	return errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled)
+}
+
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (b *Bot) handleMessage(ctx context.Context, evt *events.Message) {
+	b.recordPoll(ctx, evt)
+	if evt.Info.IsFromMe || !b.contactAllowed(evt) {
+		return
+	}
+	if evt.Info.IsGroup && !b.shouldReplyInGroup(evt) {
+		return
+	}
+	if b.seen.Seen(seenKey(evt.Info.Chat, evt.Info.ID)) {
+		b.log.Debug("duplicate message ignored", "chat", evt.Info.Chat, "message_id", evt.Info.ID)
+		return
+	}
+
+	b.metrics.messagesReceived.Add(1)
+	kind := messageType(evt.Message)
+	b.logMessage(ctx, loggedMessage{
+		Chat:      evt.Info.Chat.ToNonAD().String(),
+		ID:        evt.Info.ID,
+		Sender:    evt.Info.Sender.ToNonAD().String(),
+		Direction: directionIn,
+		Type:      kind,
+		Text:      extractMessageText(evt.Message, true),
+		At:        evt.Info.Timestamp,
+	})
+	if b.replyTypes.Skips(kind) {
+		b.log.Debug("message type not in REPLY_MESSAGE_TYPES, ignored", "chat", evt.Info.Chat, "message_id", evt.Info.ID, "type", kind)
+		return
+	}
+	if b.handleNonText(ctx, evt) {
+		return
+	}
+
+	settings := b.current()
+	text := extractMessageText(evt.Message, !settings.ignoreImageCaptions)
+	if evt.Message.GetPollUpdateMessage() != nil {
+		vote, err := b.pollVoteText(ctx, evt)
+		if err != nil {
+			b.log.Warn("poll vote not readable", "chat", evt.Info.Chat, "message_id", evt.Info.ID, "error", err)
+			return
+		}
+		if vote == "" {
+			b.log.Info("poll vote cleared", "chat", evt.Info.Chat, "message_id", evt.Info.ID)
+			return
+		}
+		text = vote
+	}
+	if contacts := sharedContacts(evt.Message); text == "" && len(contacts) > 0 {
+		b.log.Info("contact card received", "chat", evt.Info.Chat, "message_id", evt.Info.ID, "contacts", len(contacts))
+		text = contactsText(contacts)
+	}
+	audio := evt.Message.GetAudioMessage()
+	image := evt.Message.GetImageMessage()
+	if !settings.vision {
+		image = nil
+	}
+	if settings.transcriber == nil {
+		audio = nil
+	}
+	document := evt.Message.GetDocumentMessage()
+	if text == "" && audio == nil && image == nil && document == nil {
+		b.ignoreUnsupported(evt)
+		return
+	}
+
+	if text != "" && b.dispatchCommand(ctx, evt, text) {
+		return
 	}
 
-	deviceStore, err := container.GetFirstDevice()
+	chat := evt.Info.Chat.ToNonAD().String()
+	logger := b.log.With("chat", chat, "message_id", evt.Info.ID)
+	if err := b.followups.Cancel(ctx, chat); err != nil {
+		logger.Error("cancel followup failed", "error", err)
+	}
+	if b.handleOptOut(ctx, evt.Info.Chat, text) {
+		return
+	}
+	inHandoff, err := b.handoff.Active(ctx, chat)
 	if err != nil {
-		log.Fatalf("get device: %v", err)
+		logger.Error("check handoff failed", "error", err)
+	}
+	if inHandoff {
+		return
 	}
 
-	client := whatsmeow.NewClient(deviceStore, waLogger)
-	ai := NewOpenAIClient(cfg)
+	if b.maintenance.Active() {
+		logger.Info("maintenance mode, message not answered", "type", messageType(evt.Message))
+		if text != "" {
+			b.recordTranscript(logger, chat, evt.Info.Sender.ToNonAD().String(), directionIn, text)
+			if err := b.history.Append(ctx, chat, chatMessage{Role: "user", Content: text}); err != nil {
+				logger.Error("save history failed", "error", err)
+			}
+		}
+		if settings.maintenanceMessage != "" && b.maintenance.Notify(chat) {
+			b.sendText(ctx, evt.Info.Chat, settings.maintenanceMessage)
+		}
+		return
+	}
 
-	client.AddEventHandler(func(evt interface{}) {
-		switch v := evt.(type) {
-		case *events.Message:
-			go handleMessage(ctx, client, ai, v)
+	if allowed, notify := b.limiter.Allow(chat); !allowed {
+		logger.Warn("rate limited")
+		if notify && b.rateLimitNotify {
+			b.sendText(ctx, evt.Info.Chat, rateLimitMessage)
 		}
-	})
+		return
+	}
+
+	if !b.hours.Open(time.Now()) {
+		logger.Info("outside business hours")
+		b.sendText(ctx, evt.Info.Chat, settings.afterHoursMessage)
+		return
+	}
 
-	if client.Store.ID == nil {
-		qrChan, err := client.GetQRChannel(ctx)
+	replyCtx, cancel := context.WithTimeout(ctx, b.messageTimeout)
+	defer cancel()
+	replyCtx = withIdempotencyKey(replyCtx, chat+"/"+evt.Info.ID)
+	replyCtx, locationRequested := withLocationRequest(replyCtx)
+	replyCtx, quoted := withQuoteTracking(replyCtx)
+
+	if text == "" && audio != nil {
+		transcript, err := transcribeAudio(replyCtx, b.client, b.media, settings.transcriber, audio)
+		if aborted(ctx, err) {
+			logger.Info("message aborted by shutdown", "stage", "transcribe")
+			return
+		}
 		if err != nil {
-			log.Fatalf("get qr channel: %v", err)
+			logger.Error("transcribe failed", "error", err)
+			if errors.Is(replyCtx.Err(), context.DeadlineExceeded) {
+				b.sendText(ctx, evt.Info.Chat, settings.errorMessages.Timeout)
+			}
+			return
+		}
+		text = transcript
+	}
+
+	// A document's body is third-party text: an invoice or price list may
+	// well contain a blocked word, so only the caption is screened and the
+	// body just has to fit.
+	if verdict := b.filter.Screen(strings.TrimSpace(text + "\n" + document.GetCaption())); verdict.Blocked {
+		logger.Warn("message blocked by content filter", "reason", verdict.Reason)
+		if settings.blockedReply != "" {
+			b.sendText(ctx, evt.Info.Chat, settings.blockedReply)
 		}
-		if err := client.Connect(); err != nil {
-			log.Fatalf("connect: %v", err)
+		return
+	}
+
+	if document != nil {
+		content, err := documentPrompt(replyCtx, b.client, b.media, document, b.maxDocumentBytes)
+		if aborted(ctx, err) {
+			logger.Info("message aborted by shutdown", "stage", "document")
+			return
 		}
-		for evt := range qrChan {
-			if evt.Event == "code" {
-				fmt.Printf("Scan QR: %s\n", evt.Code)
+		if err != nil {
+			logger.Warn("document not readable", "error", err, "mimetype", document.GetMimetype(), "bytes", document.GetFileLength())
+			if errors.Is(replyCtx.Err(), context.DeadlineExceeded) {
+				b.sendText(ctx, evt.Info.Chat, settings.errorMessages.Timeout)
 			} else {
-				log.Printf("qr event: %s", evt.Event)
+				b.sendText(ctx, evt.Info.Chat, documentErrorReply(err))
+			}
+			return
+		}
+		text = content
+	}
+
+	verdict := b.filter.Limit(text)
+	if verdict.TooLong {
+		logger.Info("message rejected as too long", "chars", len([]rune(text)))
+		b.sendText(ctx, evt.Info.Chat, b.longInputMessage)
+		return
+	}
+	if verdict.Reason != "" {
+		logger.Info("message sanitized by content filter", "reason", verdict.Reason)
+		if b.longInputNotice != "" {
+			b.sendText(ctx, evt.Info.Chat, b.longInputNotice)
+		}
+	}
+	text = verdict.Text
+	if b.moderate(replyCtx, logger, settings, "input", text) {
+		b.sendText(ctx, evt.Info.Chat, settings.moderation.Message)
+		return
+	}
+
+	messages, err := b.history.Load(ctx, chat)
+	if err != nil {
+		logger.Error("load history failed", "error", err)
+	}
+	// Only answers that depend on nothing but the text itself can be shared.
+	cacheable := err == nil && len(messages) == 0 && image == nil && document == nil
+	userMsg := chatMessage{Role: "user", Content: text}
+	prompt := userMsg
+	if image != nil {
+		prompt, err = imageMessage(replyCtx, b.client, b.media, image, text)
+		if aborted(ctx, err) {
+			logger.Info("message aborted by shutdown", "stage", "image")
+			return
+		}
+		if err != nil {
+			logger.Error("image download failed", "error", err)
+			if errors.Is(replyCtx.Err(), context.DeadlineExceeded) {
+				b.sendText(ctx, evt.Info.Chat, settings.errorMessages.Timeout)
 			}
+			return
 		}
-	} else {
-		if err := client.Connect(); err != nil {
-			log.Fatalf("connect: %v", err)
+		userMsg = chatMessage{Role: "user", Content: prompt.Content}
+	}
+	if quote, ok := b.quotedContext(evt.Message); ok {
+		messages = append(messages, quote)
+		cacheable = false
+	}
+	messages = append(messages, prompt)
+	b.recordTranscript(logger, chat, evt.Info.Sender.ToNonAD().String(), directionIn, userMsg.Content)
+	chunks, err := b.knowledge.Search(replyCtx, text)
+	if err != nil {
+		logger.Warn("knowledge search fell back to keywords", "error", err)
+	}
+	if len(chunks) > 0 {
+		logger.Debug("knowledge chunks added", "count", len(chunks), "top_source", chunks[0].Source)
+		messages = append([]chatMessage{knowledgeMessage(chunks)}, messages...)
+	}
+	if settings.contextMetadata {
+		messages = append([]chatMessage{contextMetadata(evt.Info.PushName, time.Now(), b.location)}, messages...)
+		cacheable = false
+	}
+	lang := defaultLanguage
+	if settings.multilingual {
+		lang, _ = detectLanguage(text)
+		logger.Debug("language detected", "language", lang)
+	}
+
+	systemPrompt, hasChatPrompt, err := b.chatPrompts.Get(ctx, chat)
+	if err != nil {
+		logger.Error("load chat prompt failed", "error", err)
+	}
+	// A chat prompt wins over the language prompt, so the model still
+	// needs to be told which language to answer in.
+	languagePrompt := settings.languagePrompts[lang]
+	if hasChatPrompt {
+		languagePrompt = ""
+	}
+	if settings.multilingual && languagePrompt == "" {
+		messages = append([]chatMessage{languageInstruction(lang)}, messages...)
+	}
+	if !hasChatPrompt {
+		systemPrompt = b.prompt.Get()
+		if languagePrompt != "" {
+			// Timed prompts are written in Spanish; a customer writing in
+			// another language gets that language's prompt instead.
+			systemPrompt, hasChatPrompt = languagePrompt, true
+		} else if timed, ok := settings.timedPrompts.Select(time.Now()); ok {
+			logger.Debug("timed system prompt selected", "name", timed.name)
+			systemPrompt = timed.text
+			hasChatPrompt = true
+		}
+	}
+	if c, ok := b.customers.Lookup(evt.Info.Sender.ToNonAD().User); ok {
+		logger.Debug("customer found", "name", c.Name)
+		systemPrompt += "\n\n" + c.PromptContext()
+		hasChatPrompt = true
+	}
+	if isPromptTemplate(systemPrompt) {
+		rendered, err := renderPrompt(systemPrompt, b.promptData(time.Now()))
+		if err != nil {
+			logger.Warn("system prompt template failed, using it as is", "error", err)
+		} else {
+			systemPrompt = rendered
+			hasChatPrompt = true
 		}
 	}
+	if hasChatPrompt {
+		replyCtx = withSystemPrompt(replyCtx, systemPrompt)
+		cacheable = false
+	}
 
-	<-ctx.Done()
-	client.Disconnect()
+	messages, dropped := b.history.Fit(messages, systemPrompt)
+	if dropped > 0 {
+		logger.Info("history trimmed to fit context", "dropped_messages", dropped, "max_context_tokens", b.history.maxTokens)
+	}
+
+	first, err := b.contacts.FirstSeen(ctx, chat)
+	if err != nil {
+		logger.Error("record contact failed", "error", err)
+	}
+	if first && settings.welcomeMessage != "" && evt.Info.Chat.Server != webServer {
+		logger.Info("welcoming new contact")
+		b.sendText(ctx, evt.Info.Chat, settings.welcomeMessage)
+	}
+
+	b.setTyping(ctx, evt.Info.Chat, true)
+	defer b.setTyping(ctx, evt.Info.Chat, false)
+
+	freight := b.extractFreightRequest(replyCtx, chat, messages, logger)
+	if freight != nil {
+		if missing := freight.Missing(); len(missing) > 0 {
+			messages = append([]chatMessage{freightFollowupMessage(missing)}, messages...)
+			cacheable = false
+		}
+	}
+
+	var (
+		reply    string
+		usage    tokenUsage
+		replyErr error
+		cached   bool
+	)
+	start := time.Now()
+	if cacheable {
+		reply, cached = b.replyCache.Get(text)
+	}
+	if !cached && image == nil && document == nil {
+		if answer, ok := settings.greetings.Match(text); ok {
+			logger.Info("answered with greeting reply")
+			reply, cached = answer, true
+		}
+	}
+	if !cached && image == nil && document == nil {
+		entry, score, ok, err := b.faq.Match(replyCtx, text)
+		if err != nil {
+			logger.Warn("faq match failed", "error", err)
+		} else if ok {
+			logger.Info("answered from faq", "question", entry.Question, "similarity", score)
+			reply, cached = entry.Answer, true
+		}
+	}
+	var stream *streamEditor
+	if !cached && settings.streamEdits && evt.Info.Chat.Server != webServer {
+		stream = b.newStreamEditor(ctx, evt.Info.Chat, logger)
+		defer stream.Abandon()
+		replyCtx = withStreamDeltas(replyCtx, stream.Add)
+	}
+	if !cached {
+		stopNotice := b.startSlowReplyNotice(ctx, evt.Info.Chat, logger)
+		var release func()
+		release, replyErr = b.requests.Acquire(replyCtx)
+		if replyErr == nil {
+			reply, usage, replyErr = replyWithUsage(replyCtx, settings.ai, messages)
+			release()
+			b.metrics.ObserveReply(time.Since(start))
+		}
+		if replyErr == nil {
+			if reply = settings.replyFilters.Apply(reply); reply == "" {
+				replyErr = badResponse(errors.New("reply is empty after REPLY_FILTERS"))
+			}
+		}
+		stopNotice()
+	}
+	latency := time.Since(start)
+	failed := replyErr != nil
+	if failed {
+		switch {
+		case aborted(ctx, replyErr):
+			logger.Info("message aborted by shutdown", "stage", "reply", "latency_ms", latency.Milliseconds())
+			return
+		case errors.Is(replyErr, errTooBusy):
+			logger.Warn("reply skipped, too many AI requests in flight", "waited_ms", latency.Milliseconds())
+		case errors.Is(replyErr, errCircuitOpen):
+			b.metrics.aiErrors.Add(1)
+			logger.Warn("reply skipped, AI provider unavailable")
+		case errors.Is(replyErr, errAuth):
+			b.metrics.aiErrors.Add(1)
+			logger.Error("ai provider rejected the credentials, check the API key", "error", replyErr)
+		default:
+			b.metrics.aiErrors.Add(1)
+			logger.Error("openai reply failed", "error", replyErr, "kind", aiErrorKind(replyErr), "latency_ms", latency.Milliseconds())
+		}
+		reply = settings.errorMessages.For(replyCtx, replyErr)
+	} else if !cached && b.moderate(replyCtx, logger, settings, "reply", reply) {
+		// A blocked reply is handled like a failed one: nothing is stored,
+		// cached or sent to the webhook.
+		reply, failed = settings.moderation.Message, true
+	}
+
+	result := sendDelivered
+	if !stream.Finish(reply) {
+		// The typing indicator stays on while the reply is held back.
+		settings.replyDelay.Wait(replyCtx, reply, time.Since(start))
+		if result = b.sendReply(ctx, evt, reply); result == sendFailed {
+			return
+		}
+	}
+	// A duplicate was not sent again, so it is neither counted nor
+	// recorded as a reply.
+	if result == sendDelivered {
+		b.metrics.repliesSent.Add(1)
+		b.recordTranscript(logger, chat, b.ownJID(), directionOut, reply)
+	}
+	if locationRequested.Load() && b.sendLocation(ctx, evt.Info.Chat) {
+		logger.Info("depot location sent")
+	}
+	b.markRead(ctx, evt)
+
+	if failed {
+		return
+	}
+	if cacheable && !cached && !locationRequested.Load() {
+		b.replyCache.Put(text, reply)
+	}
+	logger.Info("reply sent",
+		"cached", cached,
+		"latency_ms", latency.Milliseconds(),
+		"reply_chars", len(reply),
+		"prompt_tokens", usage.PromptTokens,
+		"completion_tokens", usage.CompletionTokens,
+		"total_tokens", usage.TotalTokens,
+		"cost_usd", usage.CostUSD,
+	)
+	// Follow-ups chase quotes the customer went quiet on, not greetings,
+	// FAQ answers or cached replies. Web chats only get replies while
+	// their request waits, a follow-up could never be delivered.
+	if !cached && (freight != nil || quoted.Load()) && evt.Info.Chat.Server != webServer {
+		if err := b.followups.Schedule(ctx, chat); err != nil {
+			logger.Error("schedule followup failed", "error", err)
+		}
+	}
+	b.webhook.Notify(webhookPayload{
+		Chat:      chat,
+		MessageID: evt.Info.ID,
+		Inbound:   userMsg.Content,
+		Reply:     reply,
+		Freight:   freight,
+		Timestamp: time.Now().UTC(),
+		Usage: webhookUsage{
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+			CostUSD:          usage.CostUSD,
+		},
+	})
+	if err := b.history.Append(ctx, chat, userMsg, chatMessage{Role: "assistant", Content: reply}); err != nil {
+		logger.Error("save history failed", "error", err)
+		return
+	}
+	b.summarizeHistory(ctx, chat, settings, logger)
+}
+
+func (b *Bot) recordTranscript(logger *slog.Logger, chat, sender, direction, text string) {
+	if err := b.transcripts.Write(time.Now(), chat, sender, direction, text); err != nil {
+		logger.Warn("transcript write failed", "error", err)
+	}
 }
 
-func handleMessage(ctx context.Context, client *whatsmeow.Client, ai *OpenAIClient, evt *events.Message) {
-	if evt.Info.IsFromMe {
+func (b *Bot) ownJID() string {
+	if b.client.Store.ID == nil {
+		return ""
+	}
+	return b.client.Store.ID.ToNonAD().String()
+}
+
+// setTyping and markRead can't pass ctx to whatsmeow, so they are skipped
+// once it is done instead.
+func (b *Bot) setTyping(ctx context.Context, chat types.JID, typing bool) {
+	if !b.current().typingIndicator || ctx.Err() != nil {
 		return
 	}
 
-	text := extractMessageText(evt.Message)
-	if text == "" {
+	state := types.ChatPresencePaused
+	if typing {
+		state = types.ChatPresenceComposing
+	}
+	if err := b.sender.SendChatPresence(chat, state, types.ChatPresenceMediaText); err != nil {
+		b.log.Warn("send presence failed", "chat", chat, "error", err)
+	}
+}
+
+func (b *Bot) markRead(ctx context.Context, evt *events.Message) {
+	if !b.current().markRead || ctx.Err() != nil {
 		return
 	}
 
-	reply, err := ai.Reply(ctx, text)
+	err := b.sender.MarkRead([]types.MessageID{evt.Info.ID}, time.Now(), evt.Info.Chat, evt.Info.Sender)
 	if err != nil {
-		log.Printf("openai error: %v", err)
-		reply = "Lo siento, hubo un error generando la respuesta."
+		b.log.Warn("mark read failed", "chat", evt.Info.Chat, "message_id", evt.Info.ID, "error", err)
 	}
+}
 
-	_, err = client.SendMessage(ctx, evt.Info.Chat, &waProto.Message{
-		Conversation: proto.String(reply),
+func (b *Bot) sendText(ctx context.Context, chat types.JID, text string) bool {
+	return b.sendMessage(ctx, chat, &waProto.Message{
+		Conversation: proto.String(text),
 	})
+}
+
+// sendResult is what became of an outbound message.
+type sendResult int
+
+const (
+	sendFailed sendResult = iota
+	sendDelivered
+	sendDuplicate
+)
+
+// sendMessage sends notices, command responses and anything else that is
+// not a reply to a customer message. Those are never deduplicated: the
+// same notice twice in a row is legitimate.
+func (b *Bot) sendMessage(ctx context.Context, chat types.JID, msg *waProto.Message) bool {
+	return b.deliver(ctx, chat, msg, "") != sendFailed
+}
+
+// deliver is the single path to client.SendMessage, so the outbound throttle
+// covers every reply, chunk and notice. When replyTo is set, the same text
+// already sent in reply to that inbound message within
+// OUTBOUND_DEDUP_WINDOW is not sent again.
+func (b *Bot) deliver(ctx context.Context, chat types.JID, msg *waProto.Message, replyTo types.MessageID) sendResult {
+	kind := messageType(msg)
+	text := outboundText(msg)
+	var key string
+	if replyTo != "" && chat.Server != webServer {
+		key = outboundKey(chat, replyTo, kind, text)
+	}
+	if key != "" && b.sent.Seen(key) {
+		b.log.Info("duplicate send skipped", "chat", chat, "type", kind)
+		b.metrics.duplicateSends.Add(1)
+		return sendDuplicate
+	}
+
+	if err := b.sendThrottle.Wait(ctx); err != nil {
+		if key != "" {
+			b.sent.Forget(key)
+		}
+		if aborted(ctx, err) {
+			b.log.Info("send aborted by shutdown", "chat", chat, "type", kind)
+		} else {
+			b.log.Warn("send cancelled while throttled", "chat", chat, "error", err)
+		}
+		return sendFailed
+	}
+	resp, err := b.sender.SendMessage(ctx, chat, msg)
 	if err != nil {
-		log.Printf("send error: %v", err)
+		if key != "" {
+			b.sent.Forget(key)
+		}
+		if aborted(ctx, err) {
+			b.log.Info("send aborted by shutdown", "chat", chat, "type", kind)
+		} else {
+			b.log.Error("send failed", "chat", chat, "error", err)
+		}
+		return sendFailed
+	}
+	b.logMessage(ctx, loggedMessage{
+		Chat:      chat.ToNonAD().String(),
+		ID:        resp.ID,
+		Sender:    b.ownJID(),
+		Direction: directionOut,
+		Type:      kind,
+		Text:      text,
+		At:        resp.Timestamp,
+	})
+	return sendDelivered
+}
+
+// outboundText is what the message log keeps of a message the bot sends:
+// the text, or the name of a location or document.
+func outboundText(msg *waProto.Message) string {
+	if loc := msg.GetLocationMessage(); loc != nil {
+		return loc.GetName()
+	}
+	if doc := msg.GetDocumentMessage(); doc != nil {
+		return doc.GetFileName()
+	}
+	return extractMessageText(msg, true)
+}
+
+func (b *Bot) logMessage(ctx context.Context, msg loggedMessage) {
+	if err := b.messageLog.Record(ctx, msg); err != nil {
+		b.log.Error("message log failed", "chat", msg.Chat, "message_id", msg.ID, "error", err)
 	}
 }
 
-func extractMessageText(msg *waProto.Message) string {
+// maxWrapperDepth bounds unwrapMessage; real messages nest two levels at most
+// (e.g. a view-once photo in a chat with disappearing messages).
+const maxWrapperDepth = 5
+
+// unwrapMessage returns the content inside disappearing, view-once and
+// document-with-caption wrappers, which otherwise hide the text and media
+// from the Get*Message accessors.
+func unwrapMessage(msg *waProto.Message) *waProto.Message {
+	for i := 0; i < maxWrapperDepth && msg != nil; i++ {
+		var inner *waProto.Message
+		switch {
+		case msg.GetEphemeralMessage() != nil:
+			inner = msg.GetEphemeralMessage().GetMessage()
+		case msg.GetViewOnceMessage() != nil:
+			inner = msg.GetViewOnceMessage().GetMessage()
+		case msg.GetViewOnceMessageV2() != nil:
+			inner = msg.GetViewOnceMessageV2().GetMessage()
+		case msg.GetViewOnceMessageV2Extension() != nil:
+			inner = msg.GetViewOnceMessageV2Extension().GetMessage()
+		case msg.GetDocumentWithCaptionMessage() != nil:
+			inner = msg.GetDocumentWithCaptionMessage().GetMessage()
+		}
+		if inner == nil {
+			return msg
+		}
+		msg = inner
+	}
+	return msg
+}
+
+// extractMessageText returns the text of msg. Image captions count as text
+// unless includeCaptions is false.
+func extractMessageText(msg *waProto.Message, includeCaptions bool) string {
+	msg = unwrapMessage(msg)
 	if msg == nil {
 		return ""
 	}
@@ -167,7 +1003,7 @@ func extractMessageText(msg *waProto.Message) string {
 		}
 	}
 
-	if image := msg.GetImageMessage(); image != nil {
+	if image := msg.GetImageMessage(); image != nil && includeCaptions {
 		if caption := strings.TrimSpace(image.GetCaption()); caption != "" {
 			return caption
 		}
@@ -176,148 +1012,193 @@ func extractMessageText(msg *waProto.Message) string {
 	return ""
 }
 
-func NewOpenAIClient(cfg Config) *OpenAIClient {
-	return &OpenAIClient{
-		apiKey:       cfg.OpenAIKey,
-		baseURL:      strings.TrimRight(cfg.OpenAIBaseURL, "/"),
-		model:        cfg.OpenAIModel,
-		httpClient:   &http.Client{Timeout: cfg.OpenAITimeout},
-		systemPrompt: cfg.SystemPrompt,
+func NewOpenAIClient(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) *OpenAIClient {
+	headers := cfg.OpenAIExtraHeaders.Clone()
+	if headers == nil {
+		headers = http.Header{}
 	}
-}
-
-func (c *OpenAIClient) Reply(ctx context.Context, userText string) (string, error) {
-	payload := chatCompletionRequest{
-		Model: c.model,
-		Messages: []chatMessage{
-			{Role: "system", Content: c.systemPrompt},
-			{Role: "user", Content: userText},
-		},
-		Temperature: 0.2,
+	if cfg.OpenAIKey != "" && !hasAuthHeader(headers) {
+		headers.Set("Authorization", "Bearer "+cfg.OpenAIKey)
 	}
 
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("encode payload: %w", err)
+	return &OpenAIClient{
+		baseURL:         strings.TrimRight(cfg.OpenAIBaseURL, "/"),
+		model:           cfg.OpenAIModel,
+		provider:        providerOpenAI,
+		headers:         headers,
+		httpClient:      newHTTPClient(cfg.OpenAITimeout, cfg.OpenAIProxy),
+		logger:          logger,
+		usage:           usage,
+		visionModel:     cfg.VisionModel,
+		visionPrompt:    cfg.VisionPrompt,
+		prompt:          prompt,
+		maxRetries:      cfg.OpenAIRetries,
+		stream:          cfg.OpenAIStream,
+		transcribeModel: cfg.TranscribeModel,
+		embeddingsModel: cfg.EmbeddingsModel,
+		moderationModel: cfg.ModerationModel,
+		fallbackModel:   cfg.OpenAIFallbackModel,
+		tools:           mergeTools(freightTools(cfg.FreightRates), depotTools(cfg.Depot)),
+		temperature:     cfg.Temperature,
+		maxTokens:       cfg.MaxTokens,
+		lengthAction:    cfg.LengthAction,
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(body))
-	if err != nil {
-		return "", fmt.Errorf("build request: %w", err)
-	}
+func (c *OpenAIClient) Reply(ctx context.Context, messages []chatMessage) (string, error) {
+	content, _, err := c.ReplyWithUsage(ctx, messages)
+	return content, err
+}
 
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+// ReplyWithUsage returns errors tagged with their kind, see classifyAIError.
+func (c *OpenAIClient) ReplyWithUsage(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	reply, usage, err := c.generate(ctx, messages)
+	return reply, usage, classifyAIError(err)
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("send request: %w", err)
+func (c *OpenAIClient) generate(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	if c.stream {
+		return c.ReplyStream(ctx, messages, streamDeltas(ctx))
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
-	}
+	var (
+		total         tokenUsage
+		partial       string
+		continuations int
+	)
+	conversation := append([]chatMessage(nil), messages...)
+	for round := 0; ; round++ {
+		payload := c.newRequest(ctx, conversation)
+		if round >= maxToolRounds {
+			payload.Tools = nil
+		}
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		return "", fmt.Errorf("openai error: %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
-	}
+		var parsed chatCompletionResponse
+		start := time.Now()
+		model, err := c.withFallback(ctx, payload, func(body []byte) error {
+			var err error
+			parsed, err = c.complete(ctx, body)
+			return err
+		})
+		if err != nil {
+			return "", tokenUsage{}, err
+		}
+		total = total.Add(c.recordUsage(model, parsed.Usage, len(conversation), time.Since(start)))
 
-	var parsed chatCompletionResponse
-	if err := json.Unmarshal(respBody, &parsed); err != nil {
-		return "", fmt.Errorf("decode response: %w", err)
-	}
+		msg, reason := parsed.Choices[0].Message, parsed.Choices[0].FinishReason
+		c.logger.Debug("completion finished", "model", model, "finish_reason", reason)
+		if len(msg.ToolCalls) == 0 {
+			partial += msg.Content
+			if reason != finishLength {
+				return strings.TrimSpace(partial), total, nil
+			}
+			c.logger.Warn("reply cut off by the token limit", "model", model, "finish_reason", reason, "max_tokens", c.maxTokens, "action", c.lengthAction)
+			if c.lengthAction != lengthContinue || continuations >= maxContinuations {
+				return noteTruncated(partial), total, nil
+			}
+			continuations++
+			conversation = append(conversation,
+				chatMessage{Role: "assistant", Content: msg.Content},
+				chatMessage{Role: "user", Content: continuePrompt})
+			continue
+		}
 
-	if len(parsed.Choices) == 0 {
-		return "", errors.New("openai returned no choices")
+		conversation = append(conversation, msg)
+		for _, call := range msg.ToolCalls {
+			result := c.tools.Call(ctx, call)
+			c.logger.Info("tool call", "tool", call.Function.Name, "arguments", call.Function.Arguments, "result", result)
+			conversation = append(conversation, chatMessage{Role: "tool", ToolCallID: call.ID, Content: result})
+		}
 	}
+}
 
-	content := strings.TrimSpace(parsed.Choices[0].Message.Content)
-	if content == "" {
-		return "", errors.New("openai returned empty content")
-	}
+func (c *OpenAIClient) recordUsage(model string, usage tokenUsage, messages int, latency time.Duration) tokenUsage {
+	return recordCompletion(c.logger, c.usage, c.provider, model, usage, messages, latency)
+}
 
-	return content, nil
+func recordCompletion(logger *slog.Logger, tracker *UsageTracker, provider, model string, usage tokenUsage, messages int, latency time.Duration) tokenUsage {
+	cost := tracker.Record(model, usage)
+	usage.CostUSD = cost
+	totals := tracker.Totals()
+	logger.Debug("ai completion",
+		"provider", provider,
+		"model", model,
+		"messages", messages,
+		"latency_ms", latency.Milliseconds(),
+		"prompt_tokens", usage.PromptTokens,
+		"completion_tokens", usage.CompletionTokens,
+		"total_tokens", usage.TotalTokens,
+		"cost_usd", cost,
+		"cumulative_tokens", totals.TotalTokens,
+		"cumulative_cost_usd", totals.CostUSD,
+	)
+	return usage
 }
 
-func loadConfig() (Config, error) {
-	timeout, err := parseTimeoutSeconds("OPENAI_TIMEOUT_SECONDS", 30*time.Second)
-	if err != nil {
-		return Config{}, err
+func (c *OpenAIClient) newRequest(ctx context.Context, messages []chatMessage) chatCompletionRequest {
+	model := c.model
+	systemPrompt := systemPromptFor(ctx, c.prompt)
+	for _, msg := range messages {
+		if msg.hasImage() {
+			model = c.visionModel
+			systemPrompt += "\n\n" + c.visionPrompt
+			break
+		}
 	}
 
-	cfg := Config{
-		OpenAIKey:      strings.TrimSpace(os.Getenv("OPENAI_API_KEY")),
-		OpenAIModel:    strings.TrimSpace(getEnv("OPENAI_MODEL", "gpt-4o-mini")),
-		OpenAIBaseURL:  strings.TrimSpace(getEnv("OPENAI_BASE_URL", "https://api.openai.com/v1")),
-		OpenAITimeout:  timeout,
-		SystemPrompt:   strings.TrimSpace(getEnv("AI_SYSTEM_PROMPT", "Sos un asistente para Fletes Ostrit. Responde en espanol de forma breve y clara.")),
-		WhatsAppDBPath: strings.TrimSpace(getEnv("WHATSAPP_DB_PATH", "data/whatsmeow.db")),
+	temperature := c.temperature
+	return chatCompletionRequest{
+		Model:       model,
+		Messages:    append([]chatMessage{{Role: "system", Content: systemPrompt}}, messages...),
+		Temperature: &temperature,
+		MaxTokens:   c.maxTokens,
+		Tools:       c.tools.Definitions(),
 	}
+}
 
-	if cfg.OpenAIKey == "" {
-		return Config{}, errors.New("OPENAI_API_KEY is required")
-	}
+func (c *OpenAIClient) withRetry(ctx context.Context, call func() error) error {
+	return retryWithBackoff(ctx, c.maxRetries, c.logger.With("provider", c.provider), call)
+}
 
-	return cfg, nil
+func (c *OpenAIClient) post(ctx context.Context, path string, body []byte) (*http.Response, error) {
+	return c.postContent(ctx, path, "application/json", body)
 }
 
-func getEnv(key, fallback string) string {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
-		return fallback
-	}
-	return value
+func (c *OpenAIClient) postContent(ctx context.Context, path, contentType string, body []byte) (*http.Response, error) {
+	headers := c.headers.Clone()
+	headers.Set("Content-Type", contentType)
+	setIdempotencyKey(ctx, headers, path, body)
+	return postHTTP(ctx, c.httpClient, c.provider, c.baseURL+path+c.query, headers, body)
 }
 
-func parseTimeoutSeconds(key string, fallback time.Duration) (time.Duration, error) {
-	value := strings.TrimSpace(os.Getenv(key))
-	if value == "" {
-		return fallback, nil
+func (c *OpenAIClient) complete(ctx context.Context, body []byte) (chatCompletionResponse, error) {
+	resp, err := c.post(ctx, "/chat/completions", body)
+	if err != nil {
+		return chatCompletionResponse{}, err
 	}
+	defer resp.Body.Close()
 
-	seconds, err := strconv.Atoi(value)
-	if err != nil || seconds <= 0 {
-		return 0, fmt.Errorf("%s must be a positive integer", key)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return chatCompletionResponse{}, fmt.Errorf("read response: %w", err)
 	}
 
-	return time.Duration(seconds) * time.Second, nil
-}
+	var parsed chatCompletionResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return chatCompletionResponse{}, badResponse(fmt.Errorf("decode response: %w", err))
+	}
 
-func loadDotEnv(path string) error {
-	file, err := os.Open(path)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
-		}
-		return err
+	if len(parsed.Choices) == 0 {
+		return chatCompletionResponse{}, badResponse(errors.New("openai returned no choices"))
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		if strings.HasPrefix(line, "export ") {
-			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
-		}
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		value := strings.TrimSpace(parts[1])
-		value = strings.Trim(value, "\"'")
-		if key == "" {
-			continue
-		}
-		if _, exists := os.LookupEnv(key); !exists {
-			_ = os.Setenv(key, value)
-		}
+	choice := parsed.Choices[0]
+	if len(choice.Message.ToolCalls) > 0 {
+		return parsed, nil
+	}
+	if err := checkFinish(choice.FinishReason, choice.Message.Content); err != nil {
+		return chatCompletionResponse{}, err
 	}
 
-	return scanner.Err()
+	return parsed, nil
 }
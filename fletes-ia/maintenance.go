@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+)
+
+// maintenanceMode pauses automatic replies while the bot stays connected.
+// Each chat gets the notice at most once per maintenance window.
+type maintenanceMode struct {
+	mu       sync.Mutex
+	active   bool
+	notified map[string]bool
+}
+
+func newMaintenanceMode(active bool) *maintenanceMode {
+	return &maintenanceMode{active: active, notified: make(map[string]bool)}
+}
+
+func (m *maintenanceMode) Active() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
+
+// Set switches maintenance on or off and reports whether it changed.
+func (m *maintenanceMode) Set(active bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active == active {
+		return false
+	}
+	m.active = active
+	m.notified = make(map[string]bool)
+	return true
+}
+
+// Notify reports whether chat still has to be told about the maintenance.
+func (m *maintenanceMode) Notify(chat string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active || m.notified[chat] {
+		return false
+	}
+	m.notified[chat] = true
+	return true
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// mediaSpoolBytes is the declared size above which downloads go through a
+// temporary file instead of being decrypted in memory.
+const mediaSpoolBytes = 1 << 20
+
+var defaultMediaTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"audio/*",
+	"application/pdf",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"text/plain",
+	"text/csv",
+}
+
+var (
+	errMediaTooLarge = errors.New("media exceeds the size limit")
+	errMediaType     = errors.New("media type not allowed")
+)
+
+type mediaMessage interface {
+	whatsmeow.DownloadableMessage
+	GetMimetype() string
+	GetFileLength() uint64
+}
+
+// mediaPolicy limits what downloadMedia accepts. Allowed entries are MIME
+// types or "type/*" wildcards; an empty list allows everything.
+type mediaPolicy struct {
+	maxBytes int64
+	allowed  []string
+}
+
+func (p mediaPolicy) allows(contentType string) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+	for _, allowed := range p.allowed {
+		if allowed == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func parseMediaTypes(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return defaultMediaTypes
+	}
+	var types []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			types = append(types, item)
+		}
+	}
+	return types
+}
+
+// downloadMedia downloads msg after checking its declared size and MIME type,
+// and checks the size again on the actual bytes. It returns the content type
+// sniffed from the data when that is more specific than the declared one.
+func downloadMedia(ctx context.Context, client *whatsmeow.Client, msg mediaMessage, policy mediaPolicy) ([]byte, string, error) {
+	declared := baseMediaType(msg.GetMimetype())
+	if declared != "" && !policy.allows(declared) {
+		return nil, "", fmt.Errorf("%w: %s", errMediaType, declared)
+	}
+	if policy.maxBytes > 0 && int64(msg.GetFileLength()) > policy.maxBytes {
+		return nil, "", errMediaTooLarge
+	}
+
+	var data []byte
+	var err error
+	if msg.GetFileLength() > mediaSpoolBytes {
+		data, err = downloadSpooled(ctx, client, msg, policy.maxBytes)
+	} else {
+		data, err = downloadContext(ctx, client, msg)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if policy.maxBytes > 0 && int64(len(data)) > policy.maxBytes {
+		return nil, "", errMediaTooLarge
+	}
+
+	contentType := declared
+	if sniffed := baseMediaType(http.DetectContentType(data)); specificMediaType(sniffed) {
+		contentType = sniffed
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if !policy.allows(contentType) {
+		return nil, "", fmt.Errorf("%w: %s", errMediaType, contentType)
+	}
+	return data, contentType, nil
+}
+
+func downloadSpooled(ctx context.Context, client *whatsmeow.Client, msg whatsmeow.DownloadableMessage, maxBytes int64) ([]byte, error) {
+	file, err := os.CreateTemp("", "fletes-media-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.DownloadToFile(msg, file)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewind temp file: %w", err)
+	}
+	reader := io.Reader(file)
+	if maxBytes > 0 {
+		reader = io.LimitReader(file, maxBytes+1)
+	}
+	return io.ReadAll(reader)
+}
+
+// downloadContext bounds client.Download by ctx. The download itself cannot be
+// interrupted, so on cancellation it finishes in the background and is dropped.
+func downloadContext(ctx context.Context, client *whatsmeow.Client, msg whatsmeow.DownloadableMessage) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		data, err := client.Download(msg)
+		done <- result{data, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.data, r.err
+	}
+}
+
+func baseMediaType(value string) string {
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(value, ";", 2)[0]))
+}
+
+// specificMediaType rejects the generic answers http.DetectContentType gives
+// for containers it cannot tell apart (XLSX is a zip, Opus audio is ogg).
+func specificMediaType(value string) bool {
+	switch value {
+	case "", "application/octet-stream", "application/zip", "application/ogg", "text/plain":
+		return false
+	}
+	return true
+}
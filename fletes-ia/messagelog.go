@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const messageLogSchema = `
+CREATE TABLE IF NOT EXISTS fletes_message_log (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	chat_jid   TEXT    NOT NULL,
+	message_id TEXT    NOT NULL,
+	sender_jid TEXT    NOT NULL,
+	direction  TEXT    NOT NULL,
+	type       TEXT    NOT NULL,
+	text       TEXT    NOT NULL,
+	created_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fletes_message_log_chat_idx
+	ON fletes_message_log (chat_jid, id);
+`
+
+type loggedMessage struct {
+	Chat      string
+	ID        string
+	Sender    string
+	Direction string
+	Type      string
+	Text      string
+	At        time.Time
+}
+
+// MessageLog is the audit trail of every message the bot accepted or sent,
+// independent of the trimmed history the model sees. A nil log is disabled.
+type MessageLog struct {
+	db *sql.DB
+}
+
+func NewMessageLog(db *sql.DB, enabled bool) (*MessageLog, error) {
+	if !enabled {
+		return nil, nil
+	}
+	if _, err := db.Exec(messageLogSchema); err != nil {
+		return nil, fmt.Errorf("create message log table: %w", err)
+	}
+	return &MessageLog{db: db}, nil
+}
+
+func (l *MessageLog) Record(ctx context.Context, msg loggedMessage) error {
+	if l == nil {
+		return nil
+	}
+	_, err := l.db.ExecContext(ctx, `
+		INSERT INTO fletes_message_log (chat_jid, message_id, sender_jid, direction, type, text, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		msg.Chat, msg.ID, msg.Sender, msg.Direction, msg.Type, msg.Text, msg.At.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("insert message log: %w", err)
+	}
+	return nil
+}
+
+// Recent returns up to limit of chat's latest messages, oldest first.
+func (l *MessageLog) Recent(ctx context.Context, chat string, limit int) ([]loggedMessage, error) {
+	if l == nil {
+		return nil, nil
+	}
+	rows, err := l.db.QueryContext(ctx, `
+		SELECT chat_jid, message_id, sender_jid, direction, type, text, created_at FROM (
+			SELECT * FROM fletes_message_log
+			WHERE chat_jid = ?
+			ORDER BY id DESC
+			LIMIT ?
+		) ORDER BY id ASC`, chat, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query message log: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []loggedMessage
+	for rows.Next() {
+		var msg loggedMessage
+		var at int64
+		if err := rows.Scan(&msg.Chat, &msg.ID, &msg.Sender, &msg.Direction, &msg.Type, &msg.Text, &at); err != nil {
+			return nil, fmt.Errorf("scan message log: %w", err)
+		}
+		msg.At = time.UnixMilli(at)
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
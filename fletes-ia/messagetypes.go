@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Fields that travel alongside real content and say nothing about what the
+// customer sent.
+var messageMetadataFields = map[protoreflect.Name]bool{
+	"messageContextInfo":           true,
+	"senderKeyDistributionMessage": true,
+}
+
+// protocolMessageTypes are generated by the app rather than typed by the
+// customer, so they are only logged at debug level.
+var protocolMessageTypes = map[string]bool{
+	"protocol":           true,
+	"sender_key_only":    true,
+	"empty":              true,
+	"keep_in_chat":       true,
+	"pin_in_chat":        true,
+	"encrypted_reaction": true,
+}
+
+// replyMessageTypes are the kinds handleMessage can answer, the default for
+// REPLY_MESSAGE_TYPES.
+var replyMessageTypes = []string{"text", "image", "audio", "document", "contact", "poll_vote", "reaction"}
+
+// replyTypeSet is the subset of replyMessageTypes that gets a reply. A nil
+// set allows them all.
+type replyTypeSet map[string]bool
+
+func parseReplyTypes(key, value string) (replyTypeSet, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(replyMessageTypes))
+	for _, kind := range replyMessageTypes {
+		known[kind] = true
+	}
+
+	set := make(replyTypeSet)
+	for _, item := range strings.Split(value, ",") {
+		kind := strings.ToLower(strings.TrimSpace(item))
+		if kind == "" {
+			continue
+		}
+		if !known[kind] {
+			return nil, fmt.Errorf("%s: unknown message type %q, use %s", key, kind, strings.Join(replyMessageTypes, ", "))
+		}
+		set[kind] = true
+	}
+	return set, nil
+}
+
+// Skips reports whether kind is one the bot could answer but the set leaves
+// out. Other kinds are handled, or ignored, as before.
+func (s replyTypeSet) Skips(kind string) bool {
+	if s == nil || s[kind] {
+		return false
+	}
+	for _, replyable := range replyMessageTypes {
+		if kind == replyable {
+			return true
+		}
+	}
+	return false
+}
+
+// messageType names the content of msg for logs and metrics, e.g. "video"
+// or "poll". Types without a dedicated name fall back to the proto field.
+func messageType(msg *waProto.Message) string {
+	switch {
+	case msg == nil:
+		return "empty"
+	case msg.GetConversation() != "" || msg.GetExtendedTextMessage() != nil:
+		return "text"
+	case msg.GetImageMessage() != nil:
+		return "image"
+	case msg.GetAudioMessage() != nil:
+		return "audio"
+	case msg.GetVideoMessage() != nil:
+		if msg.GetVideoMessage().GetGifPlayback() {
+			return "gif"
+		}
+		return "video"
+	case msg.GetPtvMessage() != nil:
+		return "video_note"
+	case msg.GetDocumentMessage() != nil:
+		return "document"
+	case msg.GetStickerMessage() != nil:
+		return "sticker"
+	case msg.GetContactMessage() != nil, msg.GetContactsArrayMessage() != nil:
+		return "contact"
+	case msg.GetLocationMessage() != nil:
+		return "location"
+	case msg.GetLiveLocationMessage() != nil:
+		return "live_location"
+	case msg.GetPollCreationMessage() != nil, msg.GetPollCreationMessageV2() != nil, msg.GetPollCreationMessageV3() != nil:
+		return "poll"
+	case msg.GetPollUpdateMessage() != nil:
+		return "poll_vote"
+	case msg.GetReactionMessage() != nil:
+		return "reaction"
+	case msg.GetEncReactionMessage() != nil:
+		return "encrypted_reaction"
+	case msg.GetButtonsResponseMessage() != nil, msg.GetTemplateButtonReplyMessage() != nil:
+		return "button_reply"
+	case msg.GetListResponseMessage() != nil:
+		return "list_reply"
+	case msg.GetProtocolMessage() != nil:
+		return "protocol"
+	case msg.GetKeepInChatMessage() != nil:
+		return "keep_in_chat"
+	case msg.GetPinInChatMessage() != nil:
+		return "pin_in_chat"
+	}
+
+	var name protoreflect.Name
+	number := protoreflect.FieldNumber(-1)
+	msg.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		if !messageMetadataFields[fd.Name()] && (number < 0 || fd.Number() < number) {
+			name, number = fd.Name(), fd.Number()
+		}
+		return true
+	})
+	switch {
+	case name != "":
+		return string(name)
+	case msg.GetSenderKeyDistributionMessage() != nil:
+		return "sender_key_only"
+	default:
+		return "empty"
+	}
+}
+
+// ignoreUnsupported records a message the bot has no handler for, including
+// audio without a transcriber and images with vision disabled.
+func (b *Bot) ignoreUnsupported(evt *events.Message) {
+	kind := messageType(evt.Message)
+	logger := b.log.With("chat", evt.Info.Chat, "message_id", evt.Info.ID, "type", kind)
+	if protocolMessageTypes[kind] {
+		logger.Debug("non-content message ignored")
+		return
+	}
+	b.metrics.ObserveUnsupported(kind)
+	logger.Info("unsupported message type ignored")
+}
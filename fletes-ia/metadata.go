@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxPushNameChars = 60
+
+var spanishWeekdays = [...]string{"domingo", "lunes", "martes", "miercoles", "jueves", "viernes", "sabado"}
+
+// contextMetadata tells the model who is writing and the local time, so it
+// can greet by name and resolve "mañana" or "el viernes". It is only added
+// to the request, never to the stored history.
+func contextMetadata(pushName string, now time.Time, loc *time.Location) chatMessage {
+	local := now.In(loc)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Fecha y hora local: %s %s (%s).",
+		spanishWeekdays[local.Weekday()], local.Format("02/01/2006 15:04"), loc)
+	if name := sanitizePushName(pushName); name != "" {
+		fmt.Fprintf(&b, " El nombre de perfil del cliente en WhatsApp es %q; puede no ser su nombre real.", name)
+	}
+	return chatMessage{Role: "system", Content: b.String()}
+}
+
+// sanitizePushName keeps the user-controlled push name from carrying line
+// breaks or long text into the system prompt.
+func sanitizePushName(name string) string {
+	name = strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+	if runes := []rune(name); len(runes) > maxPushNameChars {
+		name = string(runes[:maxPushNameChars])
+	}
+	return name
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var replyLatencyBuckets = []float64{0.25, 0.5, 1, 2, 5, 10, 30, 60}
+
+type Metrics struct {
+	started time.Time
+
+	messagesReceived  atomic.Int64
+	repliesSent       atomic.Int64
+	aiErrors          atomic.Int64
+	duplicateSends    atomic.Int64
+	moderationFlagged atomic.Int64
+
+	mu            sync.Mutex
+	latencyCounts []int64
+	latencySum    float64
+	latencyCount  int64
+	unsupported   map[string]int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{started: time.Now(), latencyCounts: make([]int64, len(replyLatencyBuckets)), unsupported: make(map[string]int64)}
+}
+
+func (m *Metrics) Uptime() time.Duration {
+	return time.Since(m.started)
+}
+
+func (m *Metrics) ObserveReply(latency time.Duration) {
+	seconds := latency.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, bound := range replyLatencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// ObserveUnsupported counts an ignored message of the given type.
+func (m *Metrics) ObserveUnsupported(kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unsupported[kind]++
+}
+
+// Unsupported returns the ignored message counts by type.
+func (m *Metrics) Unsupported() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int64, len(m.unsupported))
+	for kind, n := range m.unsupported {
+		counts[kind] = n
+	}
+	return counts
+}
+
+// WriteTo renders the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	writeCounter(cw, "fletes_messages_received_total", "Incoming messages accepted for processing.", m.messagesReceived.Load())
+	writeCounter(cw, "fletes_replies_sent_total", "Replies delivered to WhatsApp.", m.repliesSent.Load())
+	writeCounter(cw, "fletes_ai_errors_total", "Failed AI reply requests.", m.aiErrors.Load())
+	writeCounter(cw, "fletes_duplicate_sends_total", "Outbound messages skipped as duplicates of a recent send.", m.duplicateSends.Load())
+	writeCounter(cw, "fletes_moderation_flagged_total", "Messages and replies flagged by the moderation check.", m.moderationFlagged.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintln(cw, "# HELP fletes_reply_latency_seconds Latency of AI reply requests.")
+	fmt.Fprintln(cw, "# TYPE fletes_reply_latency_seconds histogram")
+	for i, bound := range replyLatencyBuckets {
+		fmt.Fprintf(cw, "fletes_reply_latency_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'g', -1, 64), m.latencyCounts[i])
+	}
+	fmt.Fprintf(cw, "fletes_reply_latency_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	fmt.Fprintf(cw, "fletes_reply_latency_seconds_sum %g\n", m.latencySum)
+	fmt.Fprintf(cw, "fletes_reply_latency_seconds_count %d\n", m.latencyCount)
+
+	fmt.Fprintln(cw, "# HELP fletes_unsupported_messages_total Incoming messages ignored because their type is not handled.")
+	fmt.Fprintln(cw, "# TYPE fletes_unsupported_messages_total counter")
+	for _, kind := range sortedKeys(m.unsupported) {
+		fmt.Fprintf(cw, "fletes_unsupported_messages_total{type=%q} %d\n", kind, m.unsupported[kind])
+	}
+	return cw.n, cw.err
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = m.WriteTo(w)
+	})
+}
+
+func sortedKeys(counts map[string]int64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCounter(w io.Writer, name, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
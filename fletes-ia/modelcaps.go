@@ -0,0 +1,59 @@
+package main
+
+import "strings"
+
+// modelCapabilities describes how a model family deviates from the chat
+// completions request we build by default.
+type modelCapabilities struct {
+	// fixedTemperature models reject any temperature but the default.
+	fixedTemperature bool
+	// completionTokens models take max_completion_tokens, which also covers
+	// reasoning tokens, instead of max_tokens.
+	completionTokens bool
+	// noTools models reject the tools field.
+	noTools bool
+}
+
+// modelFamilies is matched by prefix in order, so more specific prefixes go
+// first. Unknown models keep the default request shape.
+var modelFamilies = []struct {
+	prefix string
+	caps   modelCapabilities
+}{
+	{"o1-mini", modelCapabilities{fixedTemperature: true, completionTokens: true, noTools: true}},
+	{"o1-preview", modelCapabilities{fixedTemperature: true, completionTokens: true, noTools: true}},
+	{"o1", modelCapabilities{fixedTemperature: true, completionTokens: true}},
+	{"o3", modelCapabilities{fixedTemperature: true, completionTokens: true}},
+	{"o4", modelCapabilities{fixedTemperature: true, completionTokens: true}},
+	{"gpt-5", modelCapabilities{fixedTemperature: true, completionTokens: true}},
+}
+
+func capabilitiesFor(model string) modelCapabilities {
+	model = strings.ToLower(model)
+	// Gateways such as OpenRouter prefix the vendor: "openai/o3-mini".
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		model = name
+	}
+	for _, family := range modelFamilies {
+		if strings.HasPrefix(model, family.prefix) {
+			return family.caps
+		}
+	}
+	return modelCapabilities{}
+}
+
+// adaptRequest reshapes payload for its model. It runs right before encoding
+// so a fallback model gets its own adjustments.
+func adaptRequest(payload chatCompletionRequest) chatCompletionRequest {
+	caps := capabilitiesFor(payload.Model)
+	if caps.fixedTemperature {
+		payload.Temperature = nil
+	}
+	if caps.completionTokens {
+		payload.MaxCompletionTokens, payload.MaxTokens = payload.MaxTokens, 0
+	}
+	if caps.noTools {
+		payload.Tools = nil
+	}
+	return payload
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const (
+	moderationBlock = "block"
+	moderationWarn  = "warn"
+
+	defaultModerationMessage = "Disculpá, no podemos responder a ese mensaje. Si necesitás un flete, contanos origen, destino y qué querés llevar."
+)
+
+// Moderator checks text against a content policy.
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (moderationResult, error)
+}
+
+type moderationResult struct {
+	Flagged    bool
+	Categories []string
+}
+
+// moderationPolicy is how flagged content is handled. A moderation error
+// never stops a reply: the text is treated as not flagged.
+type moderationPolicy struct {
+	Enabled      bool
+	Action       string
+	CheckReplies bool
+	Timeout      time.Duration
+	Message      string
+}
+
+func newModerator(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) Moderator {
+	if !cfg.Moderation.Enabled || cfg.DryRun {
+		return nil
+	}
+	return NewOpenAIClient(cfg, prompt, usage, logger)
+}
+
+type moderationRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (c *OpenAIClient) Moderate(ctx context.Context, text string) (moderationResult, error) {
+	body, err := json.Marshal(moderationRequest{Model: c.moderationModel, Input: text})
+	if err != nil {
+		return moderationResult{}, fmt.Errorf("encode request: %w", err)
+	}
+
+	var result moderationResult
+	err = c.withRetry(ctx, func() error {
+		resp, err := c.post(ctx, "/moderations", body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+
+		var parsed moderationResponse
+		if err := json.Unmarshal(respBody, &parsed); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		if len(parsed.Results) == 0 {
+			return fmt.Errorf("openai returned no moderation results")
+		}
+
+		result = moderationResult{}
+		for _, item := range parsed.Results {
+			result.Flagged = result.Flagged || item.Flagged
+			for category, flagged := range item.Categories {
+				if flagged {
+					result.Categories = append(result.Categories, category)
+				}
+			}
+		}
+		sort.Strings(result.Categories)
+		return nil
+	})
+	return result, err
+}
+
+// moderate checks text, logging what was flagged, and reports whether the
+// reply should be replaced by the canned message. kind is "input" or
+// "reply", for the logs.
+func (b *Bot) moderate(ctx context.Context, logger *slog.Logger, settings botSettings, kind, text string) bool {
+	if settings.moderator == nil || text == "" {
+		return false
+	}
+	if kind == "reply" && !settings.moderation.CheckReplies {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, settings.moderation.Timeout)
+	defer cancel()
+	result, err := settings.moderator.Moderate(ctx, text)
+	if err != nil {
+		logger.Warn("moderation failed, continuing without it", "kind", kind, "error", err)
+		return false
+	}
+	if !result.Flagged {
+		return false
+	}
+
+	b.metrics.moderationFlagged.Add(1)
+	block := settings.moderation.Action == moderationBlock
+	logger.Warn("content flagged by moderation", "kind", kind, "categories", result.Categories, "blocked", block)
+	return block
+}
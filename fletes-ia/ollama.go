@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type OllamaClient struct {
+	baseURL     string
+	model       string
+	httpClient  *http.Client
+	logger      *slog.Logger
+	prompt      *promptSource
+	usage       *UsageTracker
+	maxRetries  int
+	temperature float64
+	maxTokens   int
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  ollamaOptions   `json:"options"`
+}
+
+type ollamaOptions struct {
+	Temperature float64 `json:"temperature"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+}
+
+func NewOllamaClient(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) *OllamaClient {
+	return &OllamaClient{
+		baseURL:     strings.TrimRight(cfg.OllamaBaseURL, "/"),
+		model:       cfg.OllamaModel,
+		httpClient:  &http.Client{Timeout: cfg.OpenAITimeout},
+		logger:      logger,
+		prompt:      prompt,
+		usage:       usage,
+		maxRetries:  cfg.OpenAIRetries,
+		temperature: cfg.Temperature,
+		maxTokens:   cfg.MaxTokens,
+	}
+}
+
+func (c *OllamaClient) Reply(ctx context.Context, messages []chatMessage) (string, error) {
+	content, _, err := c.ReplyWithUsage(ctx, messages)
+	return content, err
+}
+
+// ReplyWithUsage returns errors tagged with their kind, see classifyAIError.
+func (c *OllamaClient) ReplyWithUsage(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	reply, usage, err := c.generate(ctx, messages)
+	return reply, usage, classifyAIError(err)
+}
+
+func (c *OllamaClient) generate(ctx context.Context, messages []chatMessage) (string, tokenUsage, error) {
+	payload := ollamaRequest{
+		Model:   c.model,
+		Options: ollamaOptions{Temperature: c.temperature, NumPredict: c.maxTokens},
+	}
+	if system := systemPromptFor(ctx, c.prompt); system != "" {
+		payload.Messages = append(payload.Messages, ollamaMessage{Role: "system", Content: system})
+	}
+	for _, msg := range messages {
+		if msg.Role != "system" && msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		payload.Messages = append(payload.Messages, ollamaMessage{Role: msg.Role, Content: msg.Content})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", tokenUsage{}, fmt.Errorf("marshal request: %w", err)
+	}
+
+	start := time.Now()
+	var parsed ollamaResponse
+	err = retryWithBackoff(ctx, c.maxRetries, c.logger.With("provider", providerOllama), func() error {
+		headers := http.Header{}
+		headers.Set("Content-Type", "application/json")
+
+		resp, err := postHTTP(ctx, c.httpClient, providerOllama, c.baseURL+"/api/chat", headers, body)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		parsed = ollamaResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+			return badResponse(fmt.Errorf("decode response: %w", err))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", tokenUsage{}, err
+	}
+
+	content := strings.TrimSpace(parsed.Message.Content)
+	if content == "" {
+		return "", tokenUsage{}, badResponse(errors.New("ollama returned empty content"))
+	}
+
+	usage := tokenUsage{
+		PromptTokens:     parsed.PromptEvalCount,
+		CompletionTokens: parsed.EvalCount,
+		TotalTokens:      parsed.PromptEvalCount + parsed.EvalCount,
+	}
+	return content, recordCompletion(c.logger, c.usage, providerOllama, c.model, usage, len(payload.Messages), time.Since(start)), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestOllamaClient(t *testing.T, handler http.HandlerFunc) *OllamaClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := Config{
+		OllamaModel:   "llama-test",
+		OllamaBaseURL: server.URL + "/",
+		OpenAITimeout: 5 * time.Second,
+		Temperature:   0.2,
+		MaxTokens:     300,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewOllamaClient(cfg, newPromptSource("Sos un asistente de prueba.", ""), NewUsageTracker(nil), logger)
+}
+
+func TestOllamaReplySuccess(t *testing.T) {
+	var got ollamaRequest
+	client := newTestOllamaClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("path = %q, want /api/chat", r.URL.Path)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("Authorization = %q, want none", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{
+			"message": {"role": "assistant", "content": "  Hola, el flete sale $1000.  "},
+			"done": true,
+			"prompt_eval_count": 12,
+			"eval_count": 5
+		}`)
+	})
+
+	reply, usage, err := client.ReplyWithUsage(context.Background(), []chatMessage{
+		{Role: "system", Content: "Resumen: pidio un flete a Rosario."},
+		{Role: "user", Content: "cuanto sale?"},
+		{Role: "tool", Content: "resultado de una herramienta"},
+		{Role: "assistant", Content: "A Rosario?"},
+		{Role: "user", Content: "si"},
+	})
+	if err != nil {
+		t.Fatalf("ReplyWithUsage: %v", err)
+	}
+	if reply != "Hola, el flete sale $1000." {
+		t.Errorf("reply = %q", reply)
+	}
+	if usage.PromptTokens != 12 || usage.CompletionTokens != 5 || usage.TotalTokens != 17 {
+		t.Errorf("usage = %+v, want 12 + 5 = 17", usage)
+	}
+
+	if got.Model != "llama-test" || got.Stream {
+		t.Errorf("request = %+v, want llama-test without streaming", got)
+	}
+	if got.Options.Temperature != 0.2 || got.Options.NumPredict != 300 {
+		t.Errorf("options = %+v, want temperature 0.2 and num_predict 300", got.Options)
+	}
+	// History system messages stay inline, after the system prompt.
+	want := []ollamaMessage{
+		{Role: "system", Content: "Sos un asistente de prueba."},
+		{Role: "system", Content: "Resumen: pidio un flete a Rosario."},
+		{Role: "user", Content: "cuanto sale?"},
+		{Role: "assistant", Content: "A Rosario?"},
+		{Role: "user", Content: "si"},
+	}
+	if len(got.Messages) != len(want) {
+		t.Fatalf("messages = %+v, want %+v", got.Messages, want)
+	}
+	for i := range want {
+		if got.Messages[i] != want[i] {
+			t.Errorf("message %d = %+v, want %+v", i, got.Messages[i], want[i])
+		}
+	}
+}
+
+func TestOllamaReplyErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		kind    error
+	}{
+		{"server error", statusHandler(http.StatusInternalServerError), errServer},
+		{"gateway timeout", statusHandler(http.StatusGatewayTimeout), errTimeout},
+		{"malformed JSON", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"message": `)
+		}, errBadResponse},
+		{"empty content", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"message": {"role": "assistant", "content": "  "}}`)
+		}, errBadResponse},
+		{"unknown model", statusHandler(http.StatusNotFound), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestOllamaClient(t, tt.handler)
+			reply, err := client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "hola"}})
+			if err == nil || reply != "" {
+				t.Fatalf("reply = %q, err = %v, want an error", reply, err)
+			}
+			for _, kind := range []error{errAuth, errRateLimited, errTimeout, errServer, errBadResponse} {
+				if got, want := errors.Is(err, kind), kind == tt.kind; got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestOpenAIClient(t *testing.T, handler http.HandlerFunc) *OpenAIClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg := Config{
+		OpenAIKey:     "test-key",
+		OpenAIModel:   "gpt-test",
+		OpenAIBaseURL: server.URL + "/",
+		OpenAITimeout: 5 * time.Second,
+		Temperature:   0.2,
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewOpenAIClient(cfg, newPromptSource("Sos un asistente de prueba.", ""), NewUsageTracker(nil), logger)
+}
+
+func writeCompletion(w http.ResponseWriter, content string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		"usage":   map[string]int{"prompt_tokens": 12, "completion_tokens": 5, "total_tokens": 17},
+	})
+}
+
+func writeFinishedCompletion(w http.ResponseWriter, content, reason string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"choices": []map[string]any{{
+			"message":       map[string]string{"role": "assistant", "content": content},
+			"finish_reason": reason,
+		}},
+	})
+}
+
+func TestOpenAIReplySuccess(t *testing.T) {
+	var got chatCompletionRequest
+	client := newTestOpenAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %q, want /chat/completions", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		writeCompletion(w, "  Hola, el flete sale $1000.  ")
+	})
+
+	reply, usage, err := client.ReplyWithUsage(context.Background(), []chatMessage{{Role: "user", Content: "cuanto sale?"}})
+	if err != nil {
+		t.Fatalf("ReplyWithUsage: %v", err)
+	}
+	if reply != "Hola, el flete sale $1000." {
+		t.Errorf("reply = %q", reply)
+	}
+	if usage.TotalTokens != 17 {
+		t.Errorf("total tokens = %d, want 17", usage.TotalTokens)
+	}
+
+	if got.Model != "gpt-test" {
+		t.Errorf("model = %q", got.Model)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[0].Content != "Sos un asistente de prueba." {
+		t.Fatalf("messages = %+v, want system prompt then user message", got.Messages)
+	}
+	if got.Messages[1].Role != "user" || got.Messages[1].Content != "cuanto sale?" {
+		t.Errorf("user message = %+v", got.Messages[1])
+	}
+}
+
+func TestOpenAIReplyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		check   func(t *testing.T, err error)
+	}{
+		{
+			name: "empty choices",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"choices": []}`)
+			},
+			check: wantErrorContaining("no choices"),
+		},
+		{
+			name: "empty content",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeCompletion(w, "   ")
+			},
+			check: wantErrorContaining("empty content"),
+		},
+		{
+			name: "content filter",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeFinishedCompletion(w, "Lo que pediste", finishContentFilter)
+			},
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errContentFilter) {
+					t.Fatalf("err = %v, want errContentFilter", err)
+				}
+			},
+		},
+		{
+			name: "cut off before any content",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeFinishedCompletion(w, "", finishLength)
+			},
+			check: wantErrorContaining("OPENAI_MAX_TOKENS"),
+		},
+		{
+			name: "non-2xx status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error": {"message": "invalid model"}}`, http.StatusBadRequest)
+			},
+			check: func(t *testing.T, err error) {
+				var apiErr *apiError
+				if !errors.As(err, &apiErr) {
+					t.Fatalf("err = %v, want *apiError", err)
+				}
+				if apiErr.StatusCode != http.StatusBadRequest || !strings.Contains(apiErr.Body, "invalid model") {
+					t.Errorf("apiError = %+v", apiErr)
+				}
+			},
+		},
+		{
+			name: "malformed JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, `{"choices": [`)
+			},
+			check: wantErrorContaining("decode response"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestOpenAIClient(t, tt.handler)
+			reply, err := client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "hola"}})
+			if reply != "" {
+				t.Errorf("reply = %q, want empty", reply)
+			}
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestOpenAIReplyLength(t *testing.T) {
+	var requests []chatCompletionRequest
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var req chatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		requests = append(requests, req)
+		if len(requests) == 1 {
+			writeFinishedCompletion(w, "El flete a Rosario sale", finishLength)
+			return
+		}
+		writeFinishedCompletion(w, " $45.000 con IVA.", finishStop)
+	}
+
+	client := newTestOpenAIClient(t, handler)
+	reply, err := client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "cuanto sale?"}})
+	if err != nil {
+		t.Fatalf("note: %v", err)
+	}
+	if reply != noteTruncated("El flete a Rosario sale") || len(requests) != 1 {
+		t.Errorf("note: reply = %q after %d requests, want the partial reply with the note", reply, len(requests))
+	}
+
+	requests = nil
+	client = newTestOpenAIClient(t, handler)
+	client.lengthAction = lengthContinue
+	reply, err = client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "cuanto sale?"}})
+	if err != nil {
+		t.Fatalf("continue: %v", err)
+	}
+	if reply != "El flete a Rosario sale $45.000 con IVA." {
+		t.Errorf("continue: reply = %q, want both parts joined", reply)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("continue: %d requests, want 2", len(requests))
+	}
+	sent := requests[1].Messages
+	if last := sent[len(sent)-1]; last.Content != continuePrompt || sent[len(sent)-2].Content != "El flete a Rosario sale" {
+		t.Errorf("continue: second request ends with %+v, want the partial reply and the continue prompt", sent[len(sent)-2:])
+	}
+}
+
+func TestOpenAIReplyContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	client := newTestOpenAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	})
+	// Cleanups run in reverse order, so the handler returns before the
+	// server waits for it to finish.
+	t.Cleanup(func() { close(release) })
+
+	_, err := client.Reply(ctx, []chatMessage{{Role: "user", Content: "hola"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func wantErrorContaining(substr string) func(t *testing.T, err error) {
+	return func(t *testing.T, err error) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(), substr) {
+			t.Fatalf("err = %v, want error containing %q", err, substr)
+		}
+	}
+}
+
+func TestExtractMessageText(t *testing.T) {
+	tests := []struct {
+		name           string
+		msg            *waProto.Message
+		ignoreCaptions bool
+		want           string
+	}{
+		{name: "nil message", msg: nil, want: ""},
+		{name: "conversation", msg: &waProto.Message{Conversation: proto.String(" hola ")}, want: "hola"},
+		{name: "blank conversation", msg: &waProto.Message{Conversation: proto.String("  \n")}, want: ""},
+		{
+			name: "extended text",
+			msg:  &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("mirá este link https://example.com")}},
+			want: "mirá este link https://example.com",
+		},
+		{
+			name: "image caption",
+			msg:  &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("esta heladera")}},
+			want: "esta heladera",
+		},
+		{
+			name: "image without caption",
+			msg:  &waProto.Message{ImageMessage: &waProto.ImageMessage{}},
+			want: "",
+		},
+		{
+			name: "conversation wins over caption",
+			msg: &waProto.Message{
+				Conversation: proto.String("texto"),
+				ImageMessage: &waProto.ImageMessage{Caption: proto.String("caption")},
+			},
+			want: "texto",
+		},
+		{
+			name: "empty extended text falls back to caption",
+			msg: &waProto.Message{
+				ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String(" ")},
+				ImageMessage:        &waProto.ImageMessage{Caption: proto.String("caption")},
+			},
+			want: "caption",
+		},
+		{
+			name: "unsupported type",
+			msg:  &waProto.Message{VideoMessage: &waProto.VideoMessage{Caption: proto.String("video")}},
+			want: "",
+		},
+		{
+			name:           "caption ignored",
+			msg:            &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("jaja")}},
+			ignoreCaptions: true,
+			want:           "",
+		},
+		{
+			name: "text kept when captions are ignored",
+			msg: &waProto.Message{
+				ExtendedTextMessage: &waProto.ExtendedTextMessage{Text: proto.String("cuanto sale?")},
+				ImageMessage:        &waProto.ImageMessage{Caption: proto.String("jaja")},
+			},
+			ignoreCaptions: true,
+			want:           "cuanto sale?",
+		},
+		{
+			name: "disappearing message",
+			msg: &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{
+				Message: &waProto.Message{Conversation: proto.String("hola")},
+			}},
+			want: "hola",
+		},
+		{
+			name: "view once photo in a disappearing chat",
+			msg: &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{
+				Message: &waProto.Message{ViewOnceMessageV2: &waProto.FutureProofMessage{
+					Message: &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("esta mesa")}},
+				}},
+			}},
+			want: "esta mesa",
+		},
+		{
+			name: "empty wrapper",
+			msg:  &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{}},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractMessageText(tt.msg, !tt.ignoreCaptions); got != tt.want {
+				t.Errorf("extractMessageText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnwrapMessage(t *testing.T) {
+	image := &waProto.Message{ImageMessage: &waProto.ImageMessage{Caption: proto.String("foto")}}
+	document := &waProto.Message{DocumentMessage: &waProto.DocumentMessage{Caption: proto.String("remito")}}
+	wrap := func(msg *waProto.Message) *waProto.FutureProofMessage {
+		return &waProto.FutureProofMessage{Message: msg}
+	}
+
+	tests := []struct {
+		name string
+		msg  *waProto.Message
+		want *waProto.Message
+	}{
+		{name: "nil", msg: nil, want: nil},
+		{name: "plain message", msg: image, want: image},
+		{name: "ephemeral", msg: &waProto.Message{EphemeralMessage: wrap(image)}, want: image},
+		{name: "view once", msg: &waProto.Message{ViewOnceMessage: wrap(image)}, want: image},
+		{name: "view once v2 extension", msg: &waProto.Message{ViewOnceMessageV2Extension: wrap(image)}, want: image},
+		{
+			name: "ephemeral view once v2",
+			msg:  &waProto.Message{EphemeralMessage: wrap(&waProto.Message{ViewOnceMessageV2: wrap(image)})},
+			want: image,
+		},
+		{
+			name: "document with caption",
+			msg:  &waProto.Message{DocumentWithCaptionMessage: wrap(document)},
+			want: document,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unwrapMessage(tt.msg); got != tt.want {
+				t.Errorf("unwrapMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty wrapper is kept", func(t *testing.T) {
+		msg := &waProto.Message{EphemeralMessage: &waProto.FutureProofMessage{}}
+		if got := unwrapMessage(msg); got != msg {
+			t.Errorf("unwrapMessage() = %v, want the original message", got)
+		}
+	})
+}
+
+func TestOpenAIIdempotencyKey(t *testing.T) {
+	var keys []string
+	client := newTestOpenAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(idempotencyHeader))
+		if len(keys) == 1 {
+			http.Error(w, `{"error": {"message": "upstream timeout"}}`, http.StatusBadGateway)
+			return
+		}
+		writeCompletion(w, "Hola")
+	})
+	client.maxRetries = 1
+	messages := []chatMessage{{Role: "user", Content: "hola"}}
+
+	if _, err := client.Reply(withIdempotencyKey(context.Background(), "chat/msg-1"), messages); err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Fatalf("keys = %q, want the same key on the retry", keys)
+	}
+
+	if _, err := client.Reply(withIdempotencyKey(context.Background(), "chat/msg-2"), messages); err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if _, err := client.Reply(context.Background(), messages); err != nil {
+		t.Fatalf("Reply: %v", err)
+	}
+	if len(keys) != 4 || keys[2] == keys[0] || keys[3] != "" {
+		t.Fatalf("keys = %q, want a new key per message and none without one", keys)
+	}
+}
+
+func TestOpenAIReplyErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		kind    error
+	}{
+		{"unauthorized", statusHandler(http.StatusUnauthorized), errAuth},
+		{"rate limited", statusHandler(http.StatusTooManyRequests), errRateLimited},
+		{"gateway timeout", statusHandler(http.StatusGatewayTimeout), errTimeout},
+		{"server error", statusHandler(http.StatusServiceUnavailable), errServer},
+		{"malformed JSON", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"choices": [`)
+		}, errBadResponse},
+		{"empty content", func(w http.ResponseWriter, r *http.Request) {
+			writeCompletion(w, "")
+		}, errBadResponse},
+		{"bad request", statusHandler(http.StatusBadRequest), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestOpenAIClient(t, tt.handler)
+			_, err := client.Reply(context.Background(), []chatMessage{{Role: "user", Content: "hola"}})
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			for _, kind := range []error{errAuth, errRateLimited, errTimeout, errServer, errBadResponse} {
+				if got, want := errors.Is(err, kind), kind == tt.kind; got != want {
+					t.Errorf("errors.Is(%v, %v) = %v, want %v", err, kind, got, want)
+				}
+			}
+			var apiErr *apiError
+			if tt.kind != errBadResponse && !errors.As(err, &apiErr) {
+				t.Errorf("err = %v, want it to wrap the *apiError", err)
+			}
+		})
+	}
+}
+
+func statusHandler(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"message": "nope"}}`, status)
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	const stream = ": keep-alive\r\n" +
+		"data: {\"a\":1}\r\n\r\n" +
+		"event: message\n" +
+		"data: primera linea\n" +
+		"data:segunda linea\n\n" +
+		"data: [DONE]\n\n" +
+		"data: after done\n\n"
+
+	for _, tc := range []struct {
+		name   string
+		reader func(io.Reader) io.Reader
+	}{
+		{"whole", func(r io.Reader) io.Reader { return r }},
+		{"one byte at a time", iotest.OneByteReader},
+		{"half reads", iotest.HalfReader},
+		{"data errors late", iotest.DataErrReader},
+	} {
+		var events []string
+		err := readSSE(tc.reader(strings.NewReader(stream)), func(data string) error {
+			events = append(events, data)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if want := []string{`{"a":1}`, "primera linea\nsegunda linea"}; strings.Join(events, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: events = %q, want %q and nothing after [DONE]", tc.name, events, want)
+		}
+	}
+
+	var events []string
+	if err := readSSE(iotest.OneByteReader(strings.NewReader("data: [DONE]\n\ndata: {}\n\n")), func(data string) error {
+		events = append(events, data)
+		return nil
+	}); err != nil || len(events) != 0 {
+		t.Errorf("early [DONE]: events %q, err %v, want none", events, err)
+	}
+
+	events = nil
+	if err := readSSE(strings.NewReader("data: sin cierre"), func(data string) error {
+		events = append(events, data)
+		return nil
+	}); err != nil || len(events) != 1 || events[0] != "sin cierre" {
+		t.Errorf("event cut by EOF: events %q, err %v, want it delivered", events, err)
+	}
+
+	boom := errors.New("boom")
+	if err := readSSE(strings.NewReader("data: {}\n\n"), func(string) error { return boom }); !errors.Is(err, boom) {
+		t.Errorf("callback error = %v, want it returned", err)
+	}
+	if err := readSSE(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("data: {}\n\n"))), func(string) error { return nil }); !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("read error = %v, want it returned", err)
+	}
+}
+
+func TestOpenAIReplyStreamSplitChunks(t *testing.T) {
+	client := newTestOpenAIClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		body := `data: {"choices":[{"delta":{"content":"Sale "}}]}` + "\n\n" +
+			`data: {"choices":[{"delta":{"content":"$45.000"},"finish_reason":"stop"}]}` + "\n\n" +
+			`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}` + "\n\n" +
+			"data: [DONE]\n\n"
+		// Events straddle the writes, as they do across TCP reads.
+		for len(body) > 0 {
+			n := min(7, len(body))
+			w.Write([]byte(body[:n]))
+			w.(http.Flusher).Flush()
+			body = body[n:]
+		}
+	})
+
+	var deltas []string
+	reply, usage, err := client.ReplyStream(context.Background(), []chatMessage{{Role: "user", Content: "hola"}}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != "Sale $45.000" || strings.Join(deltas, "|") != "Sale |$45.000" || usage.TotalTokens != 17 {
+		t.Errorf("reply %q, deltas %q, usage %+v", reply, deltas, usage)
+	}
+}
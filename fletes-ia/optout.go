@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	defaultOptOutMessage = "Listo, no vas a recibir más respuestas automáticas. Si querés volver a activarlas, escribí ALTA."
+	defaultOptInMessage  = "Listo, volvimos a activar las respuestas automáticas. ¿En qué te podemos ayudar?"
+)
+
+const optOutSchema = `
+CREATE TABLE IF NOT EXISTS fletes_opt_outs (
+	chat_jid     TEXT    PRIMARY KEY,
+	opted_out_at INTEGER NOT NULL
+);
+`
+
+// OptOutStore records the chats that asked the bot to stop replying.
+type OptOutStore struct {
+	db *sql.DB
+}
+
+func NewOptOutStore(db *sql.DB) (*OptOutStore, error) {
+	if _, err := db.Exec(optOutSchema); err != nil {
+		return nil, fmt.Errorf("create opt-out table: %w", err)
+	}
+	return &OptOutStore{db: db}, nil
+}
+
+func (s *OptOutStore) Add(ctx context.Context, chat string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_opt_outs (chat_jid, opted_out_at) VALUES (?, ?)
+		ON CONFLICT (chat_jid) DO NOTHING`, chat, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("add opt-out: %w", err)
+	}
+	return nil
+}
+
+func (s *OptOutStore) Remove(ctx context.Context, chat string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM fletes_opt_outs WHERE chat_jid = ?`, chat); err != nil {
+		return fmt.Errorf("remove opt-out: %w", err)
+	}
+	return nil
+}
+
+func (s *OptOutStore) Active(ctx context.Context, chat string) (bool, error) {
+	var at int64
+	err := s.db.QueryRowContext(ctx, `SELECT opted_out_at FROM fletes_opt_outs WHERE chat_jid = ?`, chat).Scan(&at)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query opt-out: %w", err)
+	}
+	return true, nil
+}
+
+// keywordSet matches whole messages such as "baja" or "STOP!" against a
+// list of keywords, ignoring case and trailing punctuation.
+type keywordSet map[string]bool
+
+func parseKeywords(value string) keywordSet {
+	set := keywordSet{}
+	for _, item := range strings.Split(value, ",") {
+		if keyword := normalizeKeyword(item); keyword != "" {
+			set[keyword] = true
+		}
+	}
+	return set
+}
+
+func normalizeKeyword(text string) string {
+	return strings.ToUpper(strings.TrimRight(strings.TrimSpace(text), ".!¡ "))
+}
+
+func (k keywordSet) Match(text string) bool {
+	return k[normalizeKeyword(text)]
+}
+
+// handleOptOut applies opt-out and opt-in keywords and reports whether the
+// message must not get an automatic reply.
+func (b *Bot) handleOptOut(ctx context.Context, jid types.JID, text string) bool {
+	chat := jid.ToNonAD().String()
+	logger := b.log.With("chat", chat)
+	switch {
+	case b.optOutKeywords.Match(text):
+		if err := b.optOuts.Add(ctx, chat); err != nil {
+			logger.Error("record opt-out failed", "error", err)
+			return false
+		}
+		if err := b.followups.Cancel(ctx, chat); err != nil {
+			logger.Error("cancel followup failed", "error", err)
+		}
+		logger.Info("contact opted out")
+		b.sendText(ctx, jid, b.optOutMessage)
+		return true
+	case b.optInKeywords.Match(text):
+		optedOut, err := b.optOuts.Active(ctx, chat)
+		if err != nil || !optedOut {
+			return false
+		}
+		if err := b.optOuts.Remove(ctx, chat); err != nil {
+			logger.Error("remove opt-out failed", "error", err)
+			return true
+		}
+		logger.Info("contact opted back in")
+		b.sendText(ctx, jid, b.optInMessage)
+		return true
+	}
+
+	optedOut, err := b.optOuts.Active(ctx, chat)
+	if err != nil {
+		logger.Error("check opt-out failed", "error", err)
+		return false
+	}
+	if optedOut {
+		logger.Info("contact opted out, message not answered")
+	}
+	return optedOut
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const qrImageSize = 320
+
+// pairingState holds the latest QR code emitted by whatsmeow so it can be
+// served over HTTP on headless servers.
+type pairingState struct {
+	mu   sync.RWMutex
+	code string
+}
+
+func (p *pairingState) SetCode(code string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.code = code
+}
+
+func (p *pairingState) Code() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.code
+}
+
+// qrHandler serves the pending QR code as text, or as a PNG when png is set.
+// The ?account= parameter picks the account; without it the first one is
+// used. Whoever scans the code links the WhatsApp account, so it needs token
+// as a bearer token, or a loopback client when token is empty.
+func qrHandler(runners []*accountRunner, token string, png bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !qrAuthorized(r, token) {
+			if token != "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "qr code only served to localhost, set QR_TOKEN", http.StatusForbidden)
+			return
+		}
+
+		runner := runners[0]
+		if name := r.URL.Query().Get("account"); name != "" {
+			runner = nil
+			for _, candidate := range runners {
+				if candidate.name == name {
+					runner = candidate
+				}
+			}
+			if runner == nil {
+				http.Error(w, "unknown account", http.StatusNotFound)
+				return
+			}
+		}
+		if runner.cfg.WhatsAppDisabled {
+			http.Error(w, "whatsapp disabled", http.StatusServiceUnavailable)
+			return
+		}
+		client, pairing := runner.client, runner.pairing
+
+		if client.Store.ID != nil {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("already paired\n"))
+			return
+		}
+
+		code := pairing.Code()
+		if code == "" {
+			http.Error(w, "qr code not available yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		if !png {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			_, _ = w.Write([]byte(code + "\n"))
+			return
+		}
+
+		image, err := qrcode.Encode(code, qrcode.Medium, qrImageSize)
+		if err != nil {
+			http.Error(w, "encode qr code failed", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(image)
+	}
+}
+
+func qrAuthorized(r *http.Request, token string) bool {
+	if token != "" {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxPDFStreamBytes caps each inflated content stream so a crafted file
+// cannot exhaust memory.
+const maxPDFStreamBytes = 4 << 20
+
+// extractPDFText pulls the text drawn by Tj/TJ operators out of the page
+// content streams. It does not resolve font encodings, so PDFs that use CID
+// fonts (common in scanned or exported invoices) may yield little or nothing.
+func extractPDFText(data []byte) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", errors.New("not a pdf file")
+	}
+
+	var out strings.Builder
+	for rest := data; ; {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		dict := rest[:start]
+		if obj := bytes.LastIndex(dict, []byte("obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+
+		body := rest[start+len("stream"):]
+		body = bytes.TrimLeft(body, "\r\n")
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/Subtype/Image")) || bytes.Contains(dict, []byte("/Subtype /Image")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := inflate(stream)
+			if err != nil {
+				continue
+			}
+			stream = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		if bytes.Contains(stream, []byte("BT")) {
+			out.WriteString(pdfContentText(stream))
+		}
+	}
+	return out.String(), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	// Truncated streams are common; keep whatever inflated cleanly.
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamBytes))
+	if len(out) > 0 {
+		return out, nil
+	}
+	return nil, err
+}
+
+// pdfContentText walks a content stream and renders text-showing operators,
+// using line-moving operators as line breaks.
+func pdfContentText(content []byte) string {
+	var out, pending strings.Builder
+	var numbers []float64
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			var s string
+			s, i = pdfLiteralString(content, i+1)
+			pending.WriteString(s)
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return out.String()
+			}
+			pending.WriteString(pdfHexString(content[i+1 : i+end]))
+			i += end + 1
+		case c == '[' || c == ']':
+			i++
+		case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(content) && (content[j] == '.' || content[j] >= '0' && content[j] <= '9') {
+				j++
+			}
+			if n, err := strconv.ParseFloat(string(content[i:j]), 64); err == nil {
+				numbers = append(numbers, n)
+				// Large negative kerning inside TJ arrays separates words.
+				if n < -200 && pending.Len() > 0 {
+					pending.WriteByte(' ')
+				}
+			}
+			i = j
+		case isPDFDelimiter(c) || c == '/':
+			i++
+			if c == '/' {
+				for i < len(content) && !isPDFDelimiter(content[i]) {
+					i++
+				}
+			}
+		default:
+			j := i
+			for j < len(content) && !isPDFDelimiter(content[j]) {
+				j++
+			}
+			op := string(content[i:j])
+			i = j
+			switch op {
+			case "Tj", "TJ":
+				out.WriteString(pending.String())
+			case "'", "\"":
+				out.WriteByte('\n')
+				out.WriteString(pending.String())
+			case "T*", "ET":
+				out.WriteByte('\n')
+			case "Td", "TD":
+				if len(numbers) >= 2 && numbers[len(numbers)-1] != 0 {
+					out.WriteByte('\n')
+				} else {
+					out.WriteByte(' ')
+				}
+			}
+			pending.Reset()
+			numbers = numbers[:0]
+		}
+	}
+	return out.String()
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLiteralString decodes a (...) string starting right after the opening
+// parenthesis and returns it with the index after the closing one.
+func pdfLiteralString(content []byte, i int) (string, int) {
+	var b strings.Builder
+	depth := 1
+	for i < len(content) {
+		c := content[i]
+		i++
+		switch c {
+		case '\\':
+			if i >= len(content) {
+				return b.String(), i
+			}
+			esc := content[i]
+			i++
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				b.WriteByte(' ')
+			case '\r', '\n':
+			default:
+				if esc >= '0' && esc <= '7' {
+					code := int(esc - '0')
+					for k := 0; k < 2 && i < len(content) && content[i] >= '0' && content[i] <= '7'; k++ {
+						code = code*8 + int(content[i]-'0')
+						i++
+					}
+					b.WriteRune(rune(code))
+				} else {
+					b.WriteByte(esc)
+				}
+			}
+		case '(':
+			depth++
+			b.WriteByte(c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i
+			}
+			b.WriteByte(c)
+		default:
+			// PDFDocEncoding matches Latin-1 for the printable range.
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String(), i
+}
+
+func pdfHexString(value []byte) string {
+	cleaned := bytes.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, value)
+	if len(cleaned)%2 == 1 {
+		cleaned = append(cleaned, '0')
+	}
+	decoded, err := hex.DecodeString(string(cleaned))
+	if err != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, c := range decoded {
+		if c >= 0x20 {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// normalizeArgentinePhone returns value as an E.164 Argentine mobile number
+// (+549 + area code + subscriber). It accepts international and national
+// formats, dropping the 00 and 0 prefixes and the 15 mobile prefix that
+// follows the area code in local notation. Numbers without the 9 are assumed
+// to be mobiles, since that is what WhatsApp uses.
+func normalizeArgentinePhone(value string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+
+	digits = strings.TrimPrefix(digits, "00")
+	national, international := strings.CutPrefix(digits, "54")
+	if !international || len(digits) < 12 {
+		national = strings.TrimPrefix(digits, "0")
+	}
+	national = strings.TrimPrefix(strings.TrimPrefix(national, "0"), "9")
+
+	if len(national) == 12 {
+		// Area codes have 2 to 4 digits; the 15 comes right after them.
+		for area := 2; area <= 4; area++ {
+			if national[area:area+2] == "15" {
+				national = national[:area] + national[area+2:]
+				break
+			}
+		}
+	}
+	if len(national) != 10 {
+		return "", fmt.Errorf("invalid argentine phone number %q", value)
+	}
+	return "+549" + national, nil
+}
+
+type customer struct {
+	Name    string
+	Company string
+	Notes   string
+}
+
+// customerDB maps E.164 numbers to customers loaded from a CSV file with the
+// columns telefono,nombre[,empresa[,notas]] and a header row.
+type customerDB map[string]customer
+
+func loadCustomerDB(path string) (customerDB, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	db := customerDB{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "telefono") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected at least telefono,nombre", line)
+		}
+		phone, err := normalizeArgentinePhone(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		c := customer{Name: strings.TrimSpace(record[1])}
+		if len(record) > 2 {
+			c.Company = strings.TrimSpace(record[2])
+		}
+		if len(record) > 3 {
+			c.Notes = strings.TrimSpace(record[3])
+		}
+		db[phone] = c
+	}
+	return db, nil
+}
+
+// Lookup finds the customer for a WhatsApp user part such as 5493511234567.
+func (db customerDB) Lookup(user string) (customer, bool) {
+	if len(db) == 0 {
+		return customer{}, false
+	}
+	phone, err := normalizeArgentinePhone(user)
+	if err != nil {
+		return customer{}, false
+	}
+	c, ok := db[phone]
+	return c, ok
+}
+
+// PromptContext describes c for the system prompt.
+func (c customer) PromptContext() string {
+	var b strings.Builder
+	b.WriteString("Datos del cliente: se llama " + c.Name)
+	if c.Company != "" {
+		b.WriteString(", de " + c.Company)
+	}
+	b.WriteString(".")
+	if c.Notes != "" {
+		b.WriteString(" Notas: " + c.Notes + ".")
+	}
+	b.WriteString(" Saludalo por su nombre.")
+	return b.String()
+}
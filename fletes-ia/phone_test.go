@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestNormalizeArgentinePhone(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		// AMBA, area code 11.
+		{"+54 9 11 2345-6789", "+5491123456789"},
+		{"5491123456789", "+5491123456789"},
+		{"0054 9 11 2345 6789", "+5491123456789"},
+		{"+54 11 2345-6789", "+5491123456789"},
+		{"+54 11 15 2345 6789", "+5491123456789"},
+		{"011 15 2345-6789", "+5491123456789"},
+		{"11 15 2345 6789", "+5491123456789"},
+		{"(011) 2345-6789", "+5491123456789"},
+		{"9 11 2345 6789", "+5491123456789"},
+		{"011 15 1534-5678", "+5491115345678"},
+		// Provincial area codes of 3 and 4 digits.
+		{"+54 9 351 123-4567", "+5493511234567"},
+		{"0351 15 123-4567", "+5493511234567"},
+		{"341 15 555-1234", "+5493415551234"},
+		{"(0221) 15 412-3456", "+5492214123456"},
+		{"02944 15 12-3456", "+5492944123456"},
+		{"+54 2944 12-3456", "+5492944123456"},
+		{"0294415123456", "+5492944123456"},
+	} {
+		got, err := normalizeArgentinePhone(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("normalizeArgentinePhone(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	for _, in := range []string{"", "12345", "+1 415 555 0100", "+54 11 2345 678", "011 15 2345 67890"} {
+		if got, err := normalizeArgentinePhone(in); err == nil {
+			t.Errorf("normalizeArgentinePhone(%q) = %q, want an error", in, got)
+		}
+	}
+}
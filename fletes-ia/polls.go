@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const pollSchema = `
+CREATE TABLE IF NOT EXISTS fletes_polls (
+	message_id TEXT PRIMARY KEY,
+	chat_jid   TEXT NOT NULL,
+	question   TEXT NOT NULL,
+	options    TEXT NOT NULL
+);
+`
+
+// PollStore keeps the question and options of every poll seen in a chat,
+// since votes only carry hashes of the selected options.
+type PollStore struct {
+	db *sql.DB
+}
+
+func NewPollStore(db *sql.DB) (*PollStore, error) {
+	if _, err := db.Exec(pollSchema); err != nil {
+		return nil, fmt.Errorf("create polls table: %w", err)
+	}
+	return &PollStore{db: db}, nil
+}
+
+func (s *PollStore) Save(ctx context.Context, chat, messageID, question string, options []string) error {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return fmt.Errorf("encode poll options: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO fletes_polls (message_id, chat_jid, question, options) VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE SET question = excluded.question, options = excluded.options`,
+		messageID, chat, question, string(encoded))
+	if err != nil {
+		return fmt.Errorf("save poll: %w", err)
+	}
+	return nil
+}
+
+func (s *PollStore) Get(ctx context.Context, messageID string) (question string, options []string, ok bool, err error) {
+	var encoded string
+	err = s.db.QueryRowContext(ctx, `SELECT question, options FROM fletes_polls WHERE message_id = ?`, messageID).Scan(&question, &encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, fmt.Errorf("load poll: %w", err)
+	}
+	if err := json.Unmarshal([]byte(encoded), &options); err != nil {
+		return "", nil, false, fmt.Errorf("decode poll options: %w", err)
+	}
+	return question, options, true, nil
+}
+
+func pollCreation(msg *waProto.Message) *waProto.PollCreationMessage {
+	switch {
+	case msg.GetPollCreationMessage() != nil:
+		return msg.GetPollCreationMessage()
+	case msg.GetPollCreationMessageV2() != nil:
+		return msg.GetPollCreationMessageV2()
+	default:
+		return msg.GetPollCreationMessageV3()
+	}
+}
+
+// recordPoll stores evt's poll, including the ones the team sends from the
+// phone, so later votes can be read.
+func (b *Bot) recordPoll(ctx context.Context, evt *events.Message) {
+	poll := pollCreation(evt.Message)
+	if poll == nil {
+		return
+	}
+	options := make([]string, 0, len(poll.GetOptions()))
+	for _, option := range poll.GetOptions() {
+		options = append(options, option.GetOptionName())
+	}
+	if err := b.polls.Save(ctx, evt.Info.Chat.ToNonAD().String(), evt.Info.ID, poll.GetName(), options); err != nil {
+		b.log.Error("record poll failed", "chat", evt.Info.Chat, "message_id", evt.Info.ID, "error", err)
+	}
+}
+
+var errUnknownPoll = errors.New("vote for a poll that was not recorded")
+
+// pollVoteText decrypts a vote and describes it for the conversation. It
+// returns "" when the voter cleared their selection.
+func (b *Bot) pollVoteText(ctx context.Context, evt *events.Message) (string, error) {
+	pollID := evt.Message.GetPollUpdateMessage().GetPollCreationMessageKey().GetID()
+	question, options, ok, err := b.polls.Get(ctx, pollID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errUnknownPoll
+	}
+
+	vote, err := b.client.DecryptPollVote(evt)
+	if err != nil {
+		return "", fmt.Errorf("decrypt poll vote: %w", err)
+	}
+
+	hashes := whatsmeow.HashPollOptions(options)
+	var selected []string
+	for _, choice := range vote.GetSelectedOptions() {
+		for i, hash := range hashes {
+			if bytes.Equal(choice, hash) {
+				selected = append(selected, options[i])
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("Respondo a la encuesta %q: %s", question, strings.Join(selected, ", ")), nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	filterMarkdown   = "markdown"
+	filterBanned     = "banned_phrases"
+	filterWhitespace = "whitespace"
+
+	defaultReplyFilters = filterMarkdown + "," + filterWhitespace
+)
+
+// replyFilters is the REPLY_FILTERS pipeline applied, in order, to model
+// replies before they are sent. It holds names rather than functions so a
+// reload can compare configs.
+type replyFilters struct {
+	names  []string
+	banned []string
+}
+
+// parseReplyFilters reads a comma separated list of filter names, "none" for
+// no filters. banned_phrases needs REPLY_BANNED_PHRASES, "|" separated.
+func parseReplyFilters(key, value, bannedKey, banned string) (replyFilters, error) {
+	var filters replyFilters
+	for _, phrase := range strings.Split(banned, "|") {
+		if phrase = strings.TrimSpace(phrase); phrase != "" {
+			filters.banned = append(filters.banned, phrase)
+		}
+	}
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return filters, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.TrimSpace(item))
+		switch name {
+		case "":
+			continue
+		case filterMarkdown, filterWhitespace:
+		case filterBanned:
+			if len(filters.banned) == 0 {
+				return replyFilters{}, fmt.Errorf("%s: %s needs %s", key, filterBanned, bannedKey)
+			}
+		default:
+			return replyFilters{}, fmt.Errorf("%s: unknown filter %q, use %s, %s or %s", key, name, filterMarkdown, filterBanned, filterWhitespace)
+		}
+		filters.names = append(filters.names, name)
+	}
+	return filters, nil
+}
+
+func (f replyFilters) Apply(text string) string {
+	for _, name := range f.names {
+		switch name {
+		case filterMarkdown:
+			text = markdownToWhatsApp(text)
+		case filterBanned:
+			text = removePhrases(text, f.banned)
+		case filterWhitespace:
+			text = collapseWhitespace(text)
+		}
+	}
+	return text
+}
+
+var (
+	markdownBold    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	markdownStrike  = regexp.MustCompile(`~~(.+?)~~`)
+	markdownHeading = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t#]*$`)
+	markdownBullet  = regexp.MustCompile(`(?m)^([ \t]*)\*[ \t]+`)
+	markdownLink    = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^)\s]+)\)`)
+)
+
+// markdownToWhatsApp rewrites the Markdown models like to produce into
+// WhatsApp formatting: **bold** and __bold__ become *bold*, ~~strike~~
+// becomes ~strike~, headings turn bold, "* " bullets become "- " and links
+// show their URL.
+func markdownToWhatsApp(text string) string {
+	text = markdownBullet.ReplaceAllString(text, "$1- ")
+	text = markdownBold.ReplaceAllString(text, "*$1$2*")
+	text = markdownStrike.ReplaceAllString(text, "~$1~")
+	text = markdownHeading.ReplaceAllStringFunc(text, func(line string) string {
+		title := markdownHeading.FindStringSubmatch(line)[1]
+		return "*" + strings.Trim(title, "*_ ") + "*"
+	})
+	return markdownLink.ReplaceAllStringFunc(text, func(link string) string {
+		parts := markdownLink.FindStringSubmatch(link)
+		if parts[1] == parts[2] {
+			return parts[2]
+		}
+		return parts[1] + " (" + parts[2] + ")"
+	})
+}
+
+// removePhrases drops every occurrence of the phrases, ignoring case.
+func removePhrases(text string, phrases []string) string {
+	for _, phrase := range phrases {
+		text = regexp.MustCompile(`(?i)`+regexp.QuoteMeta(phrase)).ReplaceAllString(text, "")
+	}
+	return text
+}
+
+var (
+	repeatedSpaces   = regexp.MustCompile(`[ \t]+`)
+	repeatedNewlines = regexp.MustCompile(`\n{3,}`)
+)
+
+// collapseWhitespace squeezes runs of spaces, trims every line and leaves at
+// most one blank line between paragraphs.
+func collapseWhitespace(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(repeatedSpaces.ReplaceAllString(line, " "))
+	}
+	return strings.TrimSpace(repeatedNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const promptWatchInterval = 5 * time.Second
+
+type promptSource struct {
+	mu      sync.RWMutex
+	text    string
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func newPromptSource(text, path string) *promptSource {
+	p := &promptSource{text: text, path: path}
+	if path != "" {
+		if info, err := os.Stat(path); err == nil {
+			p.modTime, p.size = info.ModTime(), info.Size()
+		}
+	}
+	return p
+}
+
+// Set replaces the prompt text; a prompt file, if any, still wins on its
+// next change.
+func (p *promptSource) Set(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text = text
+}
+
+func (p *promptSource) Get() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.text
+}
+
+// Watch polls the prompt file and swaps in its contents whenever the
+// modification time or size changes.
+func (p *promptSource) Watch(ctx context.Context, logger *slog.Logger) {
+	if p.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(promptWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := p.reload()
+			if err != nil {
+				logger.Warn("reload system prompt failed", "path", p.path, "error", err)
+			} else if changed {
+				logger.Info("system prompt reloaded", "path", p.path)
+			}
+		}
+	}
+}
+
+func (p *promptSource) reload() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+
+	p.mu.RLock()
+	unchanged := info.ModTime().Equal(p.modTime) && info.Size() == p.size
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	text, err := readPromptFile(p.path)
+	if err != nil {
+		return false, err
+	}
+	if err := validatePromptTemplate(p.path, text); err != nil {
+		return false, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.text, p.modTime, p.size = text, info.ModTime(), info.Size()
+	return true, nil
+}
+
+func readPromptFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(string(data))
+	if text == "" {
+		return "", errors.New("prompt file is empty")
+	}
+	return text, nil
+}
+
+func loadSystemPrompt(path, fallback string) (string, error) {
+	if path == "" {
+		return fallback, nil
+	}
+	text, err := readPromptFile(path)
+	if err != nil {
+		return "", fmt.Errorf("AI_SYSTEM_PROMPT_FILE: %w", err)
+	}
+	return text, nil
+}
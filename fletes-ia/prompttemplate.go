@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// promptData is what a system prompt template can reference, e.g.
+// "Hoy es {{.Weekday}} {{.Date}}. Atendemos {{.BusinessHours}}."
+type promptData struct {
+	Date          string
+	Time          string
+	Weekday       string
+	BusinessHours string
+	DepotName     string
+	DepotAddress  string
+}
+
+func (b *Bot) promptData(now time.Time) promptData {
+	local := now.In(b.location)
+	data := promptData{
+		Date:          local.Format("02/01/2006"),
+		Time:          local.Format("15:04"),
+		Weekday:       spanishWeekdays[local.Weekday()],
+		BusinessHours: b.hours.String(),
+	}
+	if b.depot != nil {
+		data.DepotName, data.DepotAddress = b.depot.Name, b.depot.Address
+	}
+	return data
+}
+
+// isPromptTemplate keeps plain prompts, the common case, off the template
+// engine entirely.
+func isPromptTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func renderPrompt(text string, data promptData) (string, error) {
+	if !isPromptTemplate(text) {
+		return text, nil
+	}
+	tmpl, err := template.New("prompt").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// validatePromptTemplate renders text with placeholder values so typos in
+// field names are caught at startup rather than on the first message.
+func validatePromptTemplate(key, text string) error {
+	if _, err := renderPrompt(text, promptData{}); err != nil {
+		return fmt.Errorf("%s is not a valid template: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+const (
+	providerOpenAI    = "openai"
+	providerAnthropic = "anthropic"
+	providerOllama    = "ollama"
+	providerAzure     = "azure"
+)
+
+// AIProvider is the minimum a chat backend has to implement to answer
+// WhatsApp messages.
+type AIProvider interface {
+	Reply(ctx context.Context, messages []chatMessage) (string, error)
+}
+
+type usageReplier interface {
+	ReplyWithUsage(ctx context.Context, messages []chatMessage) (string, tokenUsage, error)
+}
+
+func replyWithUsage(ctx context.Context, provider AIProvider, messages []chatMessage) (string, tokenUsage, error) {
+	if replier, ok := provider.(usageReplier); ok {
+		return replier.ReplyWithUsage(ctx, messages)
+	}
+	reply, err := provider.Reply(ctx, messages)
+	return reply, tokenUsage{}, err
+}
+
+// newAIProvider builds the configured chat backend. Audio transcription
+// always goes through OpenAI, so the transcriber is nil when no OpenAI key
+// is available.
+func newAIProvider(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) (AIProvider, Transcriber, error) {
+	var transcriber Transcriber
+	if cfg.hasOpenAIAuth() && !cfg.DryRun {
+		transcriber = NewOpenAIClient(cfg, prompt, usage, logger)
+	}
+	if cfg.DryRun {
+		logger.Warn("AI_DRY_RUN enabled, replies are canned and no API is called")
+		return DryRunClient{}, transcriber, nil
+	}
+
+	var provider AIProvider
+	switch cfg.AIProvider {
+	case providerOpenAI:
+		client := NewOpenAIClient(cfg, prompt, usage, logger)
+		provider, transcriber = client, client
+	case providerAzure:
+		provider = NewAzureClient(cfg, prompt, usage, logger)
+	case providerAnthropic:
+		provider = NewAnthropicClient(cfg, prompt, usage, logger)
+	case providerOllama:
+		provider = NewOllamaClient(cfg, prompt, usage, logger)
+	default:
+		return nil, nil, fmt.Errorf("unknown AI provider %q", cfg.AIProvider)
+	}
+
+	if cfg.BreakerThreshold > 0 {
+		provider = &breakerProvider{
+			provider: provider,
+			breaker:  newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown, logger.With("provider", cfg.AIProvider)),
+		}
+	}
+	return provider, transcriber, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const chatWorkerIdle = time.Minute
+
+// chatQueue runs messages for the same chat one at a time, in arrival order,
+// while different chats are handled in parallel. Workers exit after
+// chatWorkerIdle without messages. With a debounce window, quick bursts of
+// text are merged into one message before handling.
+type chatQueue struct {
+	mu       sync.Mutex
+	size     int
+	debounce time.Duration
+	workers  map[string]chan *events.Message
+	inflight *sync.WaitGroup
+	handle   func(evt *events.Message, merged []types.MessageID)
+	logger   *slog.Logger
+}
+
+func newChatQueue(size int, debounce time.Duration, inflight *sync.WaitGroup, logger *slog.Logger, handle func(evt *events.Message, merged []types.MessageID)) *chatQueue {
+	return &chatQueue{
+		size:     size,
+		debounce: debounce,
+		workers:  make(map[string]chan *events.Message),
+		inflight: inflight,
+		handle:   handle,
+		logger:   logger,
+	}
+}
+
+// Enqueue schedules evt for its chat. It returns false and drops the message
+// when the chat already has size messages waiting.
+func (q *chatQueue) Enqueue(evt *events.Message) bool {
+	chat := evt.Info.Chat.ToNonAD().String()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.workers[chat]
+	if !ok {
+		queue = make(chan *events.Message, q.size)
+		q.workers[chat] = queue
+		go q.work(chat, queue)
+	}
+
+	q.inflight.Add(1)
+	select {
+	case queue <- evt:
+		return true
+	default:
+		q.inflight.Done()
+		q.logger.Warn("chat queue full, dropping message", "chat", chat, "message_id", evt.Info.ID)
+		return false
+	}
+}
+
+func (q *chatQueue) work(chat string, queue chan *events.Message) {
+	idle := time.NewTimer(chatWorkerIdle)
+	defer idle.Stop()
+
+	for {
+		select {
+		case evt := <-queue:
+			batch := q.collect(evt, queue)
+			for _, msg := range mergeDebounced(batch) {
+				q.handle(msg.evt, msg.merged)
+			}
+			for range batch {
+				q.inflight.Done()
+			}
+			idle.Reset(chatWorkerIdle)
+		case <-idle.C:
+			q.mu.Lock()
+			if len(queue) == 0 {
+				delete(q.workers, chat)
+				q.mu.Unlock()
+				return
+			}
+			q.mu.Unlock()
+			idle.Reset(chatWorkerIdle)
+		}
+	}
+}
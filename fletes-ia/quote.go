@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// sendReply sends text split into WhatsApp-sized chunks. Only the first
+// chunk quotes the original message. The reply is a duplicate only when
+// every chunk was skipped as one.
+func (b *Bot) sendReply(ctx context.Context, evt *events.Message, text string) sendResult {
+	result := sendDuplicate
+	for i, chunk := range splitMessage(text, b.maxMessageChars) {
+		if i > 0 {
+			if err := sleepContext(ctx, messageChunkDelay); err != nil {
+				return sendFailed
+			}
+		}
+
+		msg := &waProto.Message{Conversation: proto.String(chunk)}
+		if i == 0 && b.quoteOriginal {
+			msg = quotedReply(evt, chunk)
+		}
+		switch b.deliver(ctx, evt.Info.Chat, msg, evt.Info.ID) {
+		case sendFailed:
+			return sendFailed
+		case sendDelivered:
+			result = sendDelivered
+		}
+	}
+	return result
+}
+
+// quotedReply builds a WhatsApp reply to evt. Messages that cannot be quoted
+// (protocol messages, polls, unknown types) degrade to a plain text message.
+func quotedReply(evt *events.Message, text string) *waProto.Message {
+	quoted := quotableMessage(evt.Message)
+	if quoted == nil || evt.Info.ID == "" {
+		return &waProto.Message{Conversation: proto.String(text)}
+	}
+
+	return &waProto.Message{
+		ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text: proto.String(text),
+			ContextInfo: &waProto.ContextInfo{
+				StanzaID:      proto.String(evt.Info.ID),
+				Participant:   proto.String(evt.Info.Sender.ToNonAD().String()),
+				QuotedMessage: quoted,
+			},
+		},
+	}
+}
+
+func quotableMessage(msg *waProto.Message) *waProto.Message {
+	switch {
+	case msg == nil:
+		return nil
+	case msg.GetConversation() != "":
+		return &waProto.Message{Conversation: proto.String(msg.GetConversation())}
+	case msg.GetExtendedTextMessage() != nil:
+		return &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text: proto.String(msg.GetExtendedTextMessage().GetText()),
+		}}
+	case msg.GetImageMessage() != nil,
+		msg.GetAudioMessage() != nil,
+		msg.GetVideoMessage() != nil,
+		msg.GetDocumentMessage() != nil,
+		msg.GetStickerMessage() != nil:
+		return msg
+	default:
+		return nil
+	}
+}
+
+const maxQuotedChars = 500
+
+// quotedContext describes the message the customer is replying to, if any,
+// as a system message for the prompt. Only the directly quoted message is
+// used; quotes inside it are not followed.
+func (b *Bot) quotedContext(msg *waProto.Message) (chatMessage, bool) {
+	info := messageContextInfo(msg)
+	quoted := info.GetQuotedMessage()
+	if quoted == nil {
+		return chatMessage{}, false
+	}
+
+	text := extractMessageText(quoted, true)
+	if text == "" {
+		text = quoted.GetDocumentMessage().GetCaption()
+	}
+	if text == "" {
+		kind := messageType(quoted)
+		if kind == "empty" || protocolMessageTypes[kind] {
+			return chatMessage{}, false
+		}
+		text = "[" + kind + "]"
+	}
+	if runes := []rune(text); len(runes) > maxQuotedChars {
+		text = string(runes[:maxQuotedChars]) + "…"
+	}
+
+	author := "un mensaje anterior"
+	if own := b.client.Store.ID; own != nil && sameUser(info.GetParticipant(), *own) {
+		author = "tu mensaje anterior"
+	}
+	return chatMessage{
+		Role:    "system",
+		Content: "El cliente esta respondiendo a " + author + ": \"" + text + "\"",
+	}, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	rateLimitWindow  = time.Minute
+	rateLimitMessage = "Esperá un momento antes de enviar más mensajes, por favor."
+)
+
+type RateLimiter struct {
+	mu        sync.Mutex
+	capacity  float64
+	perSecond float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens     float64
+	updated    time.Time
+	lastNotice time.Time
+}
+
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{
+		capacity:  float64(perMinute),
+		perSecond: float64(perMinute) / rateLimitWindow.Seconds(),
+		buckets:   make(map[string]*tokenBucket),
+		now:       time.Now,
+	}
+}
+
+// Allow consumes a token for key. When the bucket is empty it reports whether
+// the caller should notify the chat, which happens at most once per window.
+func (l *RateLimiter) Allow(key string) (allowed, notify bool) {
+	if l == nil || l.capacity <= 0 {
+		return true, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.capacity, updated: now}
+		l.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updated).Seconds()
+	bucket.tokens = min(l.capacity, bucket.tokens+elapsed*l.perSecond)
+	bucket.updated = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, false
+	}
+
+	if now.Sub(bucket.lastNotice) >= rateLimitWindow {
+		bucket.lastNotice = now
+		return false, true
+	}
+	return false, false
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitWindow {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= rateLimitWindow && now.Sub(bucket.lastNotice) >= rateLimitWindow {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const thumbsUp = "👍"
+
+// handleNonText logs reactions and stickers, which carry no text for the AI,
+// and reports whether evt was one of them. A thumbs-up on one of the bot's
+// messages is acknowledged when reactionAck is set.
+func (b *Bot) handleNonText(ctx context.Context, evt *events.Message) bool {
+	logger := b.log.With("chat", evt.Info.Chat, "message_id", evt.Info.ID)
+
+	if reaction := evt.Message.GetReactionMessage(); reaction != nil {
+		toBot := reaction.GetKey().GetFromMe()
+		emoji := reaction.GetText()
+		logger.Info("reaction received",
+			"emoji", emoji,
+			"removed", emoji == "",
+			"to_bot", toBot,
+			"positive", isPositiveReaction(emoji),
+		)
+		if toBot && strings.HasPrefix(emoji, thumbsUp) && b.reactionAck != "" {
+			b.sendText(ctx, evt.Info.Chat, b.reactionAck)
+		}
+		return true
+	}
+
+	if sticker := evt.Message.GetStickerMessage(); sticker != nil {
+		logger.Info("sticker received", "animated", sticker.GetIsAnimated())
+		return true
+	}
+	return false
+}
+
+func isPositiveReaction(emoji string) bool {
+	for _, positive := range []string{thumbsUp, "❤", "😂", "😍", "🙏", "👏", "😊", "🔥"} {
+		if strings.HasPrefix(emoji, positive) {
+			return true
+		}
+	}
+	return false
+}
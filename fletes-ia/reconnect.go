@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+const (
+	reconnectBaseDelay = 2 * time.Second
+	reconnectMaxDelay  = 2 * time.Minute
+)
+
+// reconnector replaces whatsmeow's built-in auto reconnect so attempts back
+// off, are logged, and stop with the main context. After a logout it starts
+// a new pairing so the QR code shows up on the console and on /qr.
+type reconnector struct {
+	client  *whatsmeow.Client
+	pairing *pairingState
+	logger  *slog.Logger
+	outages *outageNotices
+	running atomic.Bool
+}
+
+func newReconnector(client *whatsmeow.Client, pairing *pairingState, outages *outageNotices, logger *slog.Logger) *reconnector {
+	client.EnableAutoReconnect = false
+	return &reconnector{client: client, pairing: pairing, outages: outages, logger: logger}
+}
+
+func (r *reconnector) HandleEvent(ctx context.Context, evt interface{}) {
+	if ctx.Err() != nil {
+		return
+	}
+	switch v := evt.(type) {
+	case *events.Connected:
+		r.outages.Up()
+	case *events.Disconnected:
+		r.logger.Warn("whatsapp disconnected")
+		r.outages.Down("desconexión")
+		go r.run(ctx, r.connect)
+	case *events.LoggedOut:
+		r.logger.Error("whatsapp session logged out, scan the QR code again to pair", "reason", v.Reason.String(), "on_connect", v.OnConnect)
+		r.outages.Down("se cerró la sesión (" + v.Reason.String() + ") y hubo que escanear el QR de nuevo")
+		go r.run(ctx, func(ctx context.Context) error {
+			return pairDevice(ctx, r.client, r.pairing, r.logger)
+		})
+	}
+}
+
+// outageNotices tells ADMIN_NOTIFY_JID about connection losses once
+// WhatsApp is back, since nothing can be sent while it is down. Within
+// cooldown of the last notice, outages are only counted and mentioned in the
+// next one, so a flapping connection doesn't flood the chat. A nil
+// *outageNotices does nothing.
+type outageNotices struct {
+	mu         sync.Mutex
+	since      time.Time
+	reason     string
+	lastSent   time.Time
+	suppressed int
+	cooldown   time.Duration
+	send       func(text string)
+	now        func() time.Time
+}
+
+func newOutageNotices(cooldown time.Duration, send func(text string)) *outageNotices {
+	return &outageNotices{cooldown: cooldown, send: send, now: time.Now}
+}
+
+// Down records that the connection was lost. A logout after a disconnect
+// keeps the start of the outage but replaces the reason.
+func (o *outageNotices) Down(reason string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.since.IsZero() {
+		o.since = o.now()
+		o.reason = reason
+	} else if reason != "desconexión" {
+		o.reason = reason
+	}
+}
+
+// Up ends the current outage and sends its notice unless one went out less
+// than cooldown ago.
+func (o *outageNotices) Up() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	if o.since.IsZero() {
+		o.mu.Unlock()
+		return
+	}
+	now := o.now()
+	downtime := now.Sub(o.since).Round(time.Second)
+	reason := o.reason
+	o.since, o.reason = time.Time{}, ""
+	if !o.lastSent.IsZero() && now.Sub(o.lastSent) < o.cooldown {
+		o.suppressed++
+		o.mu.Unlock()
+		return
+	}
+	suppressed := o.suppressed
+	o.lastSent, o.suppressed = now, 0
+	o.mu.Unlock()
+
+	text := fmt.Sprintf("WhatsApp volvió a conectarse después de %s sin conexión. Motivo: %s.", downtime, reason)
+	if suppressed > 0 {
+		text += fmt.Sprintf(" Además hubo %d cortes más desde el último aviso.", suppressed)
+	}
+	go o.send(text)
+}
+
+// run retries attempt with exponential backoff until it succeeds or ctx is
+// done. Only one loop runs at a time.
+func (r *reconnector) run(ctx context.Context, attempt func(context.Context) error) {
+	if !r.running.CompareAndSwap(false, true) {
+		return
+	}
+	defer r.running.Store(false)
+
+	for n := 0; ; n++ {
+		delay := reconnectDelay(n)
+		r.logger.Info("whatsapp reconnect scheduled", "attempt", n+1, "delay", delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return
+		}
+		if r.client.IsConnected() {
+			return
+		}
+		if err := attempt(ctx); err != nil {
+			r.logger.Warn("whatsapp reconnect failed", "attempt", n+1, "error", err)
+			continue
+		}
+		r.logger.Info("whatsapp reconnected", "attempt", n+1)
+		return
+	}
+}
+
+func (r *reconnector) connect(ctx context.Context) error {
+	return r.client.Connect()
+}
+
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectBaseDelay << min(attempt, 10)
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// pairDevice connects an unpaired client and publishes every QR code it gets
+// until pairing finishes.
+func pairDevice(ctx context.Context, client *whatsmeow.Client, pairing *pairingState, logger *slog.Logger) error {
+	qrChan, err := client.GetQRChannel(ctx)
+	if err != nil {
+		return fmt.Errorf("get qr channel: %w", err)
+	}
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	last := ""
+	for evt := range qrChan {
+		last = evt.Event
+		if evt.Event == "code" {
+			pairing.SetCode(evt.Code)
+			fmt.Printf("Scan QR: %s\n", evt.Code)
+			continue
+		}
+		pairing.SetCode("")
+		logger.Info("qr event", "event", evt.Event)
+	}
+	if last != whatsmeow.QRChannelSuccess.Event {
+		client.Disconnect()
+		return fmt.Errorf("pairing ended without success: %s", last)
+	}
+	return nil
+}
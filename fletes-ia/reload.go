@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// botSettings are the parts of Bot that a SIGHUP reload replaces. Each
+// message works on one snapshot, so a reload never mixes old and new values
+// within a reply.
+type botSettings struct {
+	ai                  AIProvider
+	transcriber         Transcriber
+	freightExtractor    FreightExtractor
+	moderator           Moderator
+	moderation          moderationPolicy
+	vision              bool
+	typingIndicator     bool
+	markRead            bool
+	multilingual        bool
+	languagePrompts     map[string]string
+	contextMetadata     bool
+	ignoreImageCaptions bool
+	afterHoursMessage   string
+	blockedReply        string
+	welcomeMessage      string
+	maintenanceMessage  string
+	slowReplyThreshold  time.Duration
+	slowReplyMessage    string
+	replyDelay          replyDelay
+	errorMessages       errorMessages
+	timedPrompts        timedPrompts
+	greetings           greetingReplies
+	replyFilters        replyFilters
+	streamEdits         bool
+}
+
+func newBotSettings(cfg Config, prompt *promptSource, usage *UsageTracker, logger *slog.Logger) (botSettings, error) {
+	ai, transcriber, err := newAIProvider(cfg, prompt, usage, logger)
+	if err != nil {
+		return botSettings{}, err
+	}
+	return botSettings{
+		ai:                  ai,
+		transcriber:         transcriber,
+		freightExtractor:    newFreightExtractor(cfg, prompt, usage, logger),
+		moderator:           newModerator(cfg, prompt, usage, logger),
+		moderation:          cfg.Moderation,
+		vision:              cfg.EnableVision && (cfg.AIProvider == providerOpenAI || cfg.AIProvider == providerAzure),
+		typingIndicator:     cfg.TypingIndicator,
+		markRead:            cfg.MarkRead,
+		multilingual:        cfg.Multilingual,
+		languagePrompts:     cfg.LanguagePrompts,
+		contextMetadata:     cfg.ContextMetadata,
+		ignoreImageCaptions: cfg.IgnoreImageCaptions,
+		afterHoursMessage:   cfg.AfterHoursMessage,
+		blockedReply:        cfg.BlockedReply,
+		welcomeMessage:      cfg.WelcomeMessage,
+		maintenanceMessage:  cfg.MaintenanceMessage,
+		slowReplyThreshold:  cfg.SlowReplyThreshold,
+		slowReplyMessage:    cfg.SlowReplyMessage,
+		replyDelay:          cfg.ReplyDelay,
+		errorMessages:       cfg.ErrorMessages,
+		timedPrompts:        cfg.TimedPrompts,
+		greetings:           cfg.GreetingReplies,
+		replyFilters:        cfg.ReplyFilters,
+		streamEdits:         cfg.StreamEdits,
+	}, nil
+}
+
+func (b *Bot) current() botSettings {
+	b.settingsMu.RLock()
+	defer b.settingsMu.RUnlock()
+	return b.settings
+}
+
+// reloadableConfig lists the Config fields a reload applies: everything
+// that feeds botSettings, plus the system prompt. The rest (database paths,
+// the WhatsApp session, stores, queues, HEALTH_ADDR, ...) is only read at
+// startup and needs a restart.
+var reloadableConfig = map[string]bool{
+	"OpenAIKey": true, "OpenAIModel": true, "OpenAIFallbackModel": true, "OpenAIBaseURL": true,
+	"OpenAITimeout": true, "OpenAIRetries": true, "OpenAIStream": true, "LengthAction": true, "TranscribeModel": true,
+	"OpenAIExtraHeaders": true, "OpenAIProxy": true, "Temperature": true, "MaxTokens": true,
+	"EnableVision": true, "VisionModel": true, "VisionPrompt": true, "FreightRates": true,
+	"AIProvider": true, "AnthropicKey": true, "AnthropicModel": true, "AnthropicBaseURL": true,
+	"OllamaModel": true, "OllamaBaseURL": true, "AzureKey": true, "AzureEndpoint": true,
+	"AzureDeployment": true, "AzureAPIVersion": true, "DryRun": true, "BreakerThreshold": true,
+	"BreakerCooldown": true, "FreightExtraction": true, "ModerationModel": true, "Moderation": true,
+	"SystemPrompt": true, "TypingIndicator": true, "MarkRead": true, "Multilingual": true, "LanguagePrompts": true,
+	"ContextMetadata": true, "IgnoreImageCaptions": true, "AfterHoursMessage": true,
+	"BlockedReply": true, "WelcomeMessage": true, "MaintenanceMessage": true,
+	"SlowReplyThreshold": true, "SlowReplyMessage": true, "ReplyDelay": true, "ErrorMessages": true,
+	"TimedPrompts": true, "GreetingReplies": true, "StreamEdits": true,
+	"ReplyFilters": true,
+}
+
+// configChanges compares two configs field by field and splits the
+// differences into the ones a reload applies and the ones it can't.
+func configChanges(old, next Config) (applied, fixed []string) {
+	oldValue, nextValue := reflect.ValueOf(old), reflect.ValueOf(next)
+	fields := oldValue.Type()
+	for i := 0; i < fields.NumField(); i++ {
+		field := fields.Field(i)
+		if !field.IsExported() || reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			continue
+		}
+		if reloadableConfig[field.Name] {
+			applied = append(applied, field.Name)
+		} else {
+			fixed = append(fixed, field.Name)
+		}
+	}
+	sort.Strings(applied)
+	sort.Strings(fixed)
+	return applied, fixed
+}
+
+// reloadDotEnv drops the variables the previous load took from path before
+// reading it again, so edited and deleted entries take effect.
+func reloadDotEnv(path string, previous map[string]bool) (map[string]bool, error) {
+	for key := range previous {
+		os.Unsetenv(key)
+	}
+	return loadDotEnv(path)
+}
+
+// watchReload re-reads .env and the config on SIGHUP and applies the
+// reloadable settings to every account. A config that fails to load or
+// validate is ignored and the bots keep running with the previous one.
+func watchReload(ctx context.Context, logger *slog.Logger, runners []*accountRunner, dotenv map[string]bool) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		logger.Info("reloading config")
+		applied, err := reloadDotEnv(".env", dotenv)
+		if err != nil {
+			logger.Error("reload .env failed, keeping current config", "error", err)
+			continue
+		}
+		dotenv = applied
+
+		accounts, err := loadAccounts()
+		if err != nil {
+			logger.Error("reload config failed, keeping current config", "error", err)
+			continue
+		}
+		next := make(map[string]Config, len(accounts))
+		for _, account := range accounts {
+			next[account.name] = account.cfg
+		}
+		for _, runner := range runners {
+			cfg, ok := next[runner.name]
+			if !ok {
+				runner.bot.log.Warn("account removed from WHATSAPP_ACCOUNTS, it keeps running until a restart")
+				continue
+			}
+			delete(next, runner.name)
+			if applied, ok := runner.bot.applyConfig(runner.applied, cfg); ok {
+				runner.applied = applied
+			}
+		}
+		for name := range next {
+			logger.Warn("new account needs a restart to start", "account", name)
+		}
+	}
+}
+
+// withReloadable returns current with its reloadable fields taken from next.
+func withReloadable(current, next Config) Config {
+	merged, nextValue := reflect.ValueOf(&current).Elem(), reflect.ValueOf(next)
+	for i := 0; i < merged.NumField(); i++ {
+		if reloadableConfig[merged.Type().Field(i).Name] {
+			merged.Field(i).Set(nextValue.Field(i))
+		}
+	}
+	return current
+}
+
+// applyConfig swaps in the settings built from the reloadable part of next
+// and returns the config now in use; previous is the one applied so far.
+// Fields that need a restart keep their startup values, so they are
+// reported again on every reload until the restart.
+func (b *Bot) applyConfig(previous, next Config) (Config, bool) {
+	merged := withReloadable(previous, next)
+	settings, err := newBotSettings(merged, b.prompt, b.usage, b.log)
+	if err != nil {
+		b.log.Error("reload ai provider failed, keeping current config", "error", err)
+		return previous, false
+	}
+
+	changed, fixed := configChanges(previous, next)
+	b.settingsMu.Lock()
+	b.settings = settings
+	b.settingsMu.Unlock()
+	b.prompt.Set(merged.SystemPrompt)
+
+	b.log.Info("config reloaded", "applied", changed)
+	if len(fixed) > 0 {
+		b.log.Warn("config changes need a restart to take effect", "fields", fixed)
+	}
+	return merged, true
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// webServer is the JID server of chats that come through POST /reply. They
+// run through handleMessage like any WhatsApp chat, but what the bot sends
+// them is handed back in the HTTP response instead.
+const webServer = "web"
+
+const (
+	maxReplyRequestBytes = 64 << 10
+	maxWebChatIDLength   = 64
+)
+
+var errWebChatBusy = errors.New("chat already has a request in progress")
+
+type webReply struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// webSender passes everything addressed to a WhatsApp chat on to sender and
+// collects what is addressed to a web chat for the request waiting on it.
+// token is REPLY_API_TOKEN as read at startup; a reload doesn't change it.
+type webSender struct {
+	sender MessageSender
+	token  string
+	ids    atomic.Uint64
+
+	mu      sync.Mutex
+	waiting map[string]*[]webReply
+}
+
+var _ MessageSender = (*webSender)(nil)
+
+func newWebSender(sender MessageSender, token string) *webSender {
+	return &webSender{sender: sender, token: token, waiting: make(map[string]*[]webReply)}
+}
+
+func (s *webSender) SendMessage(ctx context.Context, to types.JID, message *waProto.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error) {
+	if to.Server != webServer {
+		return s.sender.SendMessage(ctx, to, message, extra...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replies, ok := s.waiting[to.User]
+	if !ok {
+		// Follow-ups and reminders have no request left to answer.
+		return whatsmeow.SendResponse{}, fmt.Errorf("web chat %s has no request waiting", to.User)
+	}
+	*replies = append(*replies, webReply{Type: messageType(message), Text: outboundText(message)})
+	return whatsmeow.SendResponse{ID: s.nextID(), Timestamp: time.Now()}, nil
+}
+
+func (s *webSender) MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error {
+	if chat.Server == webServer {
+		return nil
+	}
+	return s.sender.MarkRead(ids, timestamp, chat, sender, receiptTypeExtra...)
+}
+
+func (s *webSender) SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error {
+	if jid.Server == webServer {
+		return nil
+	}
+	return s.sender.SendChatPresence(jid, state, media)
+}
+
+func (s *webSender) nextID() string {
+	return fmt.Sprintf("WEB%d%d", time.Now().UnixMilli(), s.ids.Add(1))
+}
+
+// Converse runs text through bot as a message from the web chat chatID and
+// returns everything the bot sent back. A chat takes one request at a time,
+// the same as the WhatsApp chat queue.
+func (s *webSender) Converse(ctx context.Context, bot *Bot, chatID, text string) ([]webReply, error) {
+	replies := []webReply{}
+	s.mu.Lock()
+	if _, busy := s.waiting[chatID]; busy {
+		s.mu.Unlock()
+		return nil, errWebChatBusy
+	}
+	s.waiting[chatID] = &replies
+	s.mu.Unlock()
+
+	jid := types.NewJID(chatID, webServer)
+	bot.handleMessage(ctx, &events.Message{
+		Info: types.MessageInfo{
+			MessageSource: types.MessageSource{Chat: jid, Sender: jid},
+			ID:            s.nextID(),
+			Timestamp:     time.Now(),
+		},
+		Message: &waProto.Message{Conversation: proto.String(text)},
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.waiting, chatID)
+	return replies, nil
+}
+
+func validWebChatID(id string) bool {
+	if id == "" || len(id) > maxWebChatIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+type replyRequest struct {
+	ChatID string `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+type replyResponse struct {
+	ChatID  string     `json:"chat_id"`
+	Reply   string     `json:"reply"`
+	Replies []webReply `json:"replies"`
+}
+
+// replyHandler serves POST /reply for the accounts with REPLY_API_TOKEN set.
+// Like /qr it takes an ?account= parameter when there are several.
+func replyHandler(runners []*accountRunner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		runner := runners[0]
+		if name := r.URL.Query().Get("account"); name != "" {
+			runner = nil
+			for _, candidate := range runners {
+				if candidate.name == name {
+					runner = candidate
+				}
+			}
+		}
+		if runner == nil || runner.web == nil {
+			http.Error(w, "unknown account", http.StatusNotFound)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || runner.web.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(runner.web.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req replyRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxReplyRequestBytes)).Decode(&req); err != nil {
+			http.Error(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if !validWebChatID(req.ChatID) {
+			http.Error(w, "chat_id must be 1-64 letters, digits, '.', '-' or '_'", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Text) == "" {
+			http.Error(w, "text is required", http.StatusBadRequest)
+			return
+		}
+
+		replies, err := runner.web.Converse(r.Context(), runner.bot, req.ChatID, req.Text)
+		if errors.Is(err, errWebChatBusy) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		texts := make([]string, 0, len(replies))
+		for _, reply := range replies {
+			if reply.Text != "" {
+				texts = append(texts, reply.Text)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(replyResponse{
+			ChatID:  req.ChatID,
+			Reply:   strings.Join(texts, "\n\n"),
+			Replies: replies,
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replyCache reuses answers to identical first messages, such as FAQs, for a
+// while. A nil cache is disabled.
+type replyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	order   *list.List
+	entries map[[sha256.Size]byte]*list.Element
+	now     func() time.Time
+}
+
+type replyCacheEntry struct {
+	key      [sha256.Size]byte
+	reply    string
+	storedAt time.Time
+}
+
+func newReplyCache(size int, ttl time.Duration) *replyCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &replyCache{
+		ttl:     ttl,
+		size:    size,
+		order:   list.New(),
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// replyCacheKey hashes text lowercased and with whitespace collapsed, so
+// "Cuánto cuesta  un flete" and "cuánto cuesta un flete" share an entry.
+func replyCacheKey(text string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(strings.Fields(strings.ToLower(text)), " ")))
+}
+
+func (c *replyCache) Get(text string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(c.now())
+	elem, ok := c.entries[replyCacheKey(text)]
+	if !ok {
+		return "", false
+	}
+	return elem.Value.(*replyCacheEntry).reply, true
+}
+
+func (c *replyCache) Put(text, reply string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := replyCacheKey(text)
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushBack(&replyCacheEntry{key: key, reply: reply, storedAt: c.now()})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+}
+
+func (c *replyCache) expire(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*replyCacheEntry).storedAt) < c.ttl {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+func (c *replyCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*replyCacheEntry).key)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replyDelay holds replies back for a while so they don't arrive the instant
+// the customer hits send. The wait is a random base between min and max plus
+// perChar for every character of the reply, capped at limit.
+type replyDelay struct {
+	min, max time.Duration
+	perChar  time.Duration
+	limit    time.Duration
+}
+
+// parseReplyDelay reads ARTIFICIAL_DELAY_MS as either "1500" or a range such
+// as "1000-3000".
+func parseReplyDelay(key, value string, perChar, limit time.Duration) (replyDelay, error) {
+	delay := replyDelay{perChar: perChar, limit: limit}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return delay, nil
+	}
+
+	low, high, isRange := strings.Cut(value, "-")
+	minMS, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil || minMS < 0 {
+		return replyDelay{}, fmt.Errorf("%s must be milliseconds or a range like 1000-3000, got %q", key, value)
+	}
+	maxMS := minMS
+	if isRange {
+		maxMS, err = strconv.Atoi(strings.TrimSpace(high))
+		if err != nil || maxMS < minMS {
+			return replyDelay{}, fmt.Errorf("%s must be milliseconds or a range like 1000-3000, got %q", key, value)
+		}
+	}
+	delay.min = time.Duration(minMS) * time.Millisecond
+	delay.max = time.Duration(maxMS) * time.Millisecond
+	return delay, nil
+}
+
+func (d replyDelay) enabled() bool {
+	return d.max > 0 || d.perChar > 0
+}
+
+// For returns how long reply should be held in total, counting from when the
+// message was received.
+func (d replyDelay) For(reply string) time.Duration {
+	wait := d.min
+	if d.max > d.min {
+		wait += rand.N(d.max - d.min + 1)
+	}
+	wait += d.perChar * time.Duration(len([]rune(reply)))
+	if d.limit > 0 && wait > d.limit {
+		wait = d.limit
+	}
+	return wait
+}
+
+// Wait sleeps until reply has been held for its delay, discounting elapsed
+// (the time already spent producing it). It returns early when ctx is done,
+// so the delay never outlives the message deadline.
+func (d replyDelay) Wait(ctx context.Context, reply string, elapsed time.Duration) {
+	if !d.enabled() {
+		return
+	}
+	wait := d.For(reply) - elapsed
+	if wait <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const (
+	followupPollInterval   = 30 * time.Second
+	defaultFollowupMessage = "Hola, ¿pudiste ver la cotización? Si tenés alguna duda, escribinos y te ayudamos."
+)
+
+const followupSchema = `
+CREATE TABLE IF NOT EXISTS fletes_followups (
+	chat_jid TEXT    PRIMARY KEY,
+	due_at   INTEGER NOT NULL
+);
+`
+
+// Scheduler sends a single follow-up to chats that went quiet after a reply.
+// A chat has at most one pending follow-up; any inbound message cancels it.
+// A nil scheduler is disabled.
+type Scheduler struct {
+	db      *sql.DB
+	delay   time.Duration
+	message string
+	now     func() time.Time
+}
+
+func NewScheduler(db *sql.DB, delay time.Duration, message string) (*Scheduler, error) {
+	if delay <= 0 {
+		return nil, nil
+	}
+	if _, err := db.Exec(followupSchema); err != nil {
+		return nil, fmt.Errorf("create followup table: %w", err)
+	}
+	return &Scheduler{db: db, delay: delay, message: message, now: time.Now}, nil
+}
+
+func (s *Scheduler) Schedule(ctx context.Context, chat string) error {
+	if s == nil {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_followups (chat_jid, due_at) VALUES (?, ?)
+		ON CONFLICT (chat_jid) DO UPDATE SET due_at = excluded.due_at`,
+		chat, s.now().Add(s.delay).Unix())
+	if err != nil {
+		return fmt.Errorf("schedule followup: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) Cancel(ctx context.Context, chat string) error {
+	if s == nil {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM fletes_followups WHERE chat_jid = ?`, chat); err != nil {
+		return fmt.Errorf("cancel followup: %w", err)
+	}
+	return nil
+}
+
+// Run sends due follow-ups until ctx is done. Follow-ups that come due
+// outside business hours or during a human handoff stay pending.
+func (s *Scheduler) Run(ctx context.Context, b *Bot, logger *slog.Logger) {
+	if s == nil {
+		return
+	}
+	ticker := time.NewTicker(followupPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.sendDue(ctx, b, logger); err != nil {
+				logger.Error("send followups failed", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Scheduler) sendDue(ctx context.Context, b *Bot, logger *slog.Logger) error {
+	now := s.now()
+	if !b.hours.Open(now) || b.maintenance.Active() {
+		return nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT chat_jid FROM fletes_followups WHERE due_at <= ?`, now.Unix())
+	if err != nil {
+		return fmt.Errorf("query followups: %w", err)
+	}
+	var due []string
+	for rows.Next() {
+		var chat string
+		if err := rows.Scan(&chat); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan followup: %w", err)
+		}
+		due = append(due, chat)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("query followups: %w", err)
+	}
+
+	for _, chat := range due {
+		if inHandoff, err := b.handoff.Active(ctx, chat); err != nil || inHandoff {
+			continue
+		}
+		if optedOut, err := b.optOuts.Active(ctx, chat); err != nil || optedOut {
+			continue
+		}
+		jid, err := types.ParseJID(chat)
+		if err != nil || jid.Server == webServer {
+			logger.Warn("invalid followup chat", "chat", chat, "error", err)
+			_ = s.Cancel(ctx, chat)
+			continue
+		}
+		if !b.sendText(ctx, jid, s.message) {
+			continue
+		}
+		logger.Info("followup sent", "chat", chat)
+		if err := s.Cancel(ctx, chat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
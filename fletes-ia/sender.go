@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MessageSender is the part of *whatsmeow.Client that replies, receipts and
+// the typing indicator go through, so the message flow can run against a
+// fake in tests. Media downloads and uploads still use the client.
+type MessageSender interface {
+	SendMessage(ctx context.Context, to types.JID, message *waProto.Message, extra ...whatsmeow.SendRequestExtra) (whatsmeow.SendResponse, error)
+	MarkRead(ids []types.MessageID, timestamp time.Time, chat, sender types.JID, receiptTypeExtra ...types.ReceiptType) error
+	SendChatPresence(jid types.JID, state types.ChatPresence, media types.ChatPresenceMedia) error
+}
+
+var _ MessageSender = (*whatsmeow.Client)(nil)
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+const (
+	defaultWhatsAppDBPath = "data/whatsmeow.db"
+	logoutConnectTimeout  = 30 * time.Second
+)
+
+func openDatabase(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on", filepath.ToSlash(path))
+	return sql.Open("sqlite", dsn)
+}
+
+// logoutSession unpairs the device stored in dbPath from the phone and
+// deletes its session, so the next start shows a new QR. If WhatsApp can't
+// be reached the session is deleted locally anyway; the phone then lists a
+// stale linked device that can be removed by hand. Chat history and other
+// bot data are kept.
+func logoutSession(dbPath string, logger *slog.Logger) error {
+	db, err := openDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("open db: %w", err)
+	}
+	defer db.Close()
+
+	container := sqlstore.NewWithDB(db, "sqlite", waLog.Stdout("DB", "ERROR", true))
+	if err := container.Upgrade(); err != nil {
+		return fmt.Errorf("init store: %w", err)
+	}
+	deviceStore, err := container.GetFirstDevice()
+	if err != nil {
+		return fmt.Errorf("get device: %w", err)
+	}
+	if deviceStore.ID == nil {
+		logger.Info("no WhatsApp session to log out", "db_path", dbPath)
+		return nil
+	}
+	jid := *deviceStore.ID
+
+	client := whatsmeow.NewClient(deviceStore, waLog.Stdout("WA", "WARN", true))
+	client.EnableAutoReconnect = false
+	if err := client.Connect(); err != nil {
+		logger.Warn("connect failed, deleting the session locally", "error", err)
+		return deleteDevice(deviceStore)
+	}
+	defer client.Disconnect()
+
+	if !client.WaitForConnection(logoutConnectTimeout) {
+		logger.Warn("WhatsApp did not accept the session, deleting it locally")
+		return deleteDevice(deviceStore)
+	}
+	if err := client.Logout(); err != nil {
+		logger.Warn("logout failed, deleting the session locally", "error", err)
+		return deleteDevice(deviceStore)
+	}
+	logger.Info("logged out of WhatsApp", "jid", jid, "db_path", dbPath)
+	return nil
+}
+
+func deleteDevice(deviceStore *store.Device) error {
+	if err := deviceStore.Delete(); err != nil && !errors.Is(err, sqlstore.ErrDeviceIDMustBeSet) {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+const defaultSlowReplyMessage = "Dame un segundo, estoy calculando..."
+
+// startSlowReplyNotice sends SLOW_REPLY_MESSAGE to chat if the reply takes
+// longer than SLOW_REPLY_THRESHOLD_MS. The returned stop cancels the notice;
+// if it already fired, stop waits for it so the reply is never sent before it.
+func (b *Bot) startSlowReplyNotice(ctx context.Context, chat types.JID, logger *slog.Logger) (stop func()) {
+	settings := b.current()
+	if settings.slowReplyThreshold <= 0 || settings.slowReplyMessage == "" {
+		return func() {}
+	}
+
+	sent := make(chan struct{})
+	timer := time.AfterFunc(settings.slowReplyThreshold, func() {
+		defer close(sent)
+		logger.Info("reply is slow, sending placeholder", "threshold", settings.slowReplyThreshold)
+		if b.sendText(ctx, chat, settings.slowReplyMessage) {
+			// Sending a message clears the typing indicator.
+			b.setTyping(ctx, chat, true)
+		}
+	})
+	return func() {
+		if !timer.Stop() {
+			<-sent
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const startupCheckTimeout = 15 * time.Second
+
+// CheckModels lists the models available to the API key and reports an
+// error unless the chat model (and fallback model, if any) is among them.
+// It catches a wrong key, base URL or model name before WhatsApp connects.
+func (c *OpenAIClient) CheckModels(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, startupCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header = c.headers.Clone()
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("reach %s: %w", c.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return errors.New("the API key was rejected (401), check OPENAI_API_KEY or OPENAI_EXTRA_HEADERS")
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s/models not found (404), check OPENAI_BASE_URL", c.baseURL)
+	case resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices:
+		return &apiError{Provider: "openai", StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return fmt.Errorf("decode models: %w", err)
+	}
+	available := make(map[string]bool, len(list.Data))
+	for _, model := range list.Data {
+		available[model.ID] = true
+	}
+	for _, model := range []string{c.model, c.fallbackModel} {
+		if model != "" && !available[model] {
+			return fmt.Errorf("model %q is not available for this API key", model)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type chatCompletionChunk struct {
+	Choices []struct {
+		Delta        chatMessage `json:"delta"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *tokenUsage `json:"usage"`
+}
+
+func (c *OpenAIClient) ReplyStream(ctx context.Context, messages []chatMessage, onDelta func(string)) (string, tokenUsage, error) {
+	payload := c.newRequest(ctx, messages)
+	payload.Stream = true
+	payload.StreamOptions = &streamOptions{IncludeUsage: true}
+	// Streamed tool calls arrive as fragments; streaming replies answer without tools.
+	payload.Tools = nil
+
+	var content string
+	var usage tokenUsage
+	start := time.Now()
+	model, err := c.withFallback(ctx, payload, func(body []byte) error {
+		var err error
+		content, err = c.completeStream(ctx, body, onDelta, &usage)
+		return err
+	})
+	if err != nil {
+		return "", tokenUsage{}, err
+	}
+
+	return content, c.recordUsage(model, usage, len(messages), time.Since(start)), nil
+}
+
+func (c *OpenAIClient) completeStream(ctx context.Context, body []byte, onDelta func(string), usage *tokenUsage) (string, error) {
+	resp, err := c.post(ctx, "/chat/completions", body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var (
+		content strings.Builder
+		reason  string
+	)
+	err = readSSE(resp.Body, func(data string) error {
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return badResponse(fmt.Errorf("decode chunk: %w", err))
+		}
+		if chunk.Usage != nil {
+			*usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != "" {
+				reason = choice.FinishReason
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if content.Len() > 0 {
+			// Deltas were already handed to the caller, so a retry would duplicate them.
+			return "", &permanentError{err: fmt.Errorf("stream interrupted: %w", err)}
+		}
+		return "", fmt.Errorf("read stream: %w", err)
+	}
+
+	c.logger.Debug("completion finished", "finish_reason", reason)
+	result := strings.TrimSpace(content.String())
+	if err := checkFinish(reason, result); err != nil {
+		return "", err
+	}
+	// Streamed text can't be continued seamlessly, so a cut off reply is
+	// always noted.
+	if reason == finishLength {
+		c.logger.Warn("reply cut off by the token limit", "finish_reason", reason, "max_tokens", c.maxTokens)
+		return noteTruncated(result), nil
+	}
+
+	return result, nil
+}
+
+// readSSE calls onEvent with the data payload of every server-sent event in r
+// until the stream ends or the OpenAI "[DONE]" sentinel is received.
+func readSSE(r io.Reader, onEvent func(data string) error) error {
+	reader := bufio.NewReader(r)
+	var data []string
+
+	flush := func() (bool, error) {
+		if len(data) == 0 {
+			return false, nil
+		}
+		payload := strings.Join(data, "\n")
+		data = data[:0]
+		if payload == "[DONE]" {
+			return true, nil
+		}
+		return false, onEvent(payload)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		eof := err != nil
+
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			done, ferr := flush()
+			if ferr != nil || done {
+				return ferr
+			}
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+
+		if eof {
+			_, ferr := flush()
+			return ferr
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const summarySchema = `
+CREATE TABLE IF NOT EXISTS fletes_conversation_summaries (
+	chat_jid   TEXT    PRIMARY KEY,
+	summary    TEXT    NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+`
+
+const summaryPrompt = `Resumí la conversación entre un cliente y el asistente de Fletes Ostrit para que el asistente pueda seguirla sin leerla completa.
+Conservá los datos concretos: nombre del cliente, origen, destino, fechas, tipo de carga, peso, volumen, precios cotizados, acuerdos y preguntas pendientes.
+Si hay un resumen anterior, integralo con los mensajes nuevos. Escribí solo el resumen, en español, en pocas líneas.`
+
+// summaryPolicy controls rolling summaries: once a chat stores more than
+// threshold messages, all but the last keep are folded into its summary.
+// A zero threshold disables it.
+type summaryPolicy struct {
+	threshold int
+	keep      int
+}
+
+func summaryMessage(summary string) chatMessage {
+	return chatMessage{Role: "system", Content: "Resumen de la conversación hasta ahora:\n" + summary}
+}
+
+func (s *ConversationStore) Summary(ctx context.Context, chat string) (string, error) {
+	var summary string
+	err := s.db.QueryRowContext(ctx, `SELECT summary FROM fletes_conversation_summaries WHERE chat_jid = ?`, chat).Scan(&summary)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("query summary: %w", err)
+	}
+	return summary, nil
+}
+
+// Summarize folds the chat's messages older than the last keep into its
+// summary when more than threshold are stored. summarize receives the
+// previous summary, possibly empty, and the messages to fold. It reports how
+// many messages were replaced.
+func (s *ConversationStore) Summarize(ctx context.Context, chat string, policy summaryPolicy, summarize func(ctx context.Context, previous string, messages []chatMessage) (string, error)) (int, error) {
+	if policy.threshold <= 0 {
+		return 0, nil
+	}
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM fletes_conversation_messages WHERE chat_jid = ?`, chat).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count history: %w", err)
+	}
+	if count <= policy.threshold {
+		return 0, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, role, content FROM fletes_conversation_messages
+		WHERE chat_jid = ?
+		ORDER BY id ASC
+		LIMIT ?`, chat, count-policy.keep)
+	if err != nil {
+		return 0, fmt.Errorf("query history: %w", err)
+	}
+	var (
+		older  []chatMessage
+		lastID int64
+	)
+	for rows.Next() {
+		var msg chatMessage
+		if err := rows.Scan(&lastID, &msg.Role, &msg.Content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan history: %w", err)
+		}
+		older = append(older, msg)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("scan history: %w", err)
+	}
+
+	previous, err := s.Summary(ctx, chat)
+	if err != nil {
+		return 0, err
+	}
+	summary, err := summarize(ctx, previous, older)
+	if err != nil {
+		return 0, fmt.Errorf("summarize history: %w", err)
+	}
+	if summary = strings.TrimSpace(summary); summary == "" {
+		return 0, errors.New("summarize history: empty summary")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin summary tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO fletes_conversation_summaries (chat_jid, summary, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (chat_jid) DO UPDATE SET summary = excluded.summary, updated_at = excluded.updated_at`,
+		chat, summary, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("save summary: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM fletes_conversation_messages WHERE chat_jid = ? AND id <= ?`, chat, lastID)
+	if err != nil {
+		return 0, fmt.Errorf("delete summarized history: %w", err)
+	}
+	return len(older), tx.Commit()
+}
+
+// summarizeHistory folds old turns of chat into its summary, using the
+// chat's AI provider with summaryPrompt as the system prompt. It runs after
+// the reply was sent, so the customer never waits for it.
+func (b *Bot) summarizeHistory(ctx context.Context, chat string, settings botSettings, logger *slog.Logger) {
+	if b.summaries.threshold <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.messageTimeout)
+	defer cancel()
+
+	replaced, err := b.history.Summarize(ctx, chat, b.summaries, func(ctx context.Context, previous string, messages []chatMessage) (string, error) {
+		var transcript strings.Builder
+		if previous != "" {
+			fmt.Fprintf(&transcript, "Resumen anterior:\n%s\n\n", previous)
+		}
+		transcript.WriteString("Mensajes nuevos:\n")
+		for _, msg := range messages {
+			speaker := "Cliente"
+			if msg.Role == "assistant" {
+				speaker = "Asistente"
+			}
+			fmt.Fprintf(&transcript, "%s: %s\n", speaker, msg.Content)
+		}
+		return settings.ai.Reply(withSystemPrompt(ctx, summaryPrompt), []chatMessage{{Role: "user", Content: transcript.String()}})
+	})
+	if err != nil {
+		logger.Warn("history summary failed, keeping full history", "error", err)
+		return
+	}
+	if replaced > 0 {
+		logger.Info("history summarized", "messages", replaced)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sendThrottle is a token bucket shared by every outbound send. A nil
+// throttle never waits.
+type sendThrottle struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newSendThrottle(perSecond float64) *sendThrottle {
+	if perSecond <= 0 {
+		return nil
+	}
+	burst := max(1, perSecond)
+	return &sendThrottle{rate: perSecond, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until a send is allowed or ctx is done.
+func (t *sendThrottle) Wait(ctx context.Context) error {
+	if t == nil {
+		return ctx.Err()
+	}
+
+	for {
+		t.mu.Lock()
+		now := time.Now()
+		t.tokens = min(t.burst, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+		t.last = now
+		if t.tokens >= 1 {
+			t.tokens--
+			t.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - t.tokens) / t.rate * float64(time.Second))
+		t.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timedPrompt replaces the system prompt while its hours are open, e.g. a
+// terser prompt for rush hour.
+type timedPrompt struct {
+	name  string
+	text  string
+	hours *BusinessHours
+}
+
+type timedPrompts []timedPrompt
+
+// parseTimedPrompts reads the prompts named in AI_TIMED_PROMPTS, each from
+// AI_SYSTEM_PROMPT_<NAME> and AI_SYSTEM_PROMPT_<NAME>_HOURS in the
+// BUSINESS_HOURS format. Windows of different prompts may not overlap, so
+// there is never more than one to pick.
+func parseTimedPrompts(names string, value func(key string) string, loc *time.Location) (timedPrompts, error) {
+	var prompts timedPrompts
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		textKey := "AI_SYSTEM_PROMPT_" + strings.ToUpper(name)
+		hoursKey := textKey + "_HOURS"
+
+		text := strings.TrimSpace(value(textKey))
+		if text == "" {
+			return nil, fmt.Errorf("AI_TIMED_PROMPTS: %s is not set", textKey)
+		}
+		if err := validatePromptTemplate(textKey, text); err != nil {
+			return nil, err
+		}
+		hours, err := parseBusinessHours(value(hoursKey), loc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hoursKey, err)
+		}
+		if hours == nil {
+			return nil, fmt.Errorf("AI_TIMED_PROMPTS: %s is not set", hoursKey)
+		}
+
+		for _, other := range prompts {
+			if other.name == name {
+				return nil, fmt.Errorf("AI_TIMED_PROMPTS: %s is listed twice", name)
+			}
+			if day, ok := other.hours.Overlap(hours); ok {
+				return nil, fmt.Errorf("AI_TIMED_PROMPTS: %s and %s overlap on %s", other.name, name, day)
+			}
+		}
+		prompts = append(prompts, timedPrompt{name: name, text: text, hours: hours})
+	}
+	return prompts, nil
+}
+
+// Select returns the prompt whose hours contain t.
+func (p timedPrompts) Select(t time.Time) (timedPrompt, bool) {
+	for _, prompt := range p {
+		if prompt.hours.Open(t) {
+			return prompt, true
+		}
+	}
+	return timedPrompt{}, false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const maxToolRounds = 4
+
+type toolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"`
+	Function toolCallFunction `json:"function"`
+}
+
+type toolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type toolDefinition struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type toolHandler func(ctx context.Context, arguments json.RawMessage) (any, error)
+
+type tool struct {
+	description string
+	parameters  json.RawMessage
+	handler     toolHandler
+}
+
+type toolRegistry map[string]tool
+
+func (r toolRegistry) Definitions() []toolDefinition {
+	if len(r) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]toolDefinition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, toolDefinition{
+			Type: "function",
+			Function: toolFunction{
+				Name:        name,
+				Description: r[name].description,
+				Parameters:  r[name].parameters,
+			},
+		})
+	}
+	return defs
+}
+
+// Call runs the requested tool and always returns a JSON document for the
+// model; failures are reported as {"error": "..."} so it can recover.
+func (r toolRegistry) Call(ctx context.Context, call toolCall) string {
+	t, ok := r[call.Function.Name]
+	if !ok {
+		return toolError(fmt.Errorf("unknown tool %q", call.Function.Name))
+	}
+
+	result, err := t.handler(ctx, json.RawMessage(call.Function.Arguments))
+	if err != nil {
+		return toolError(err)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return toolError(err)
+	}
+	return string(encoded)
+}
+
+// mergeTools combines registries, returning nil when none has tools.
+func mergeTools(registries ...toolRegistry) toolRegistry {
+	var merged toolRegistry
+	for _, r := range registries {
+		for name, t := range r {
+			if merged == nil {
+				merged = toolRegistry{}
+			}
+			merged[name] = t
+		}
+	}
+	return merged
+}
+
+func toolError(err error) string {
+	encoded, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(encoded)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+type transcriptionResponse struct {
+	Text string `json:"text"`
+}
+
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error)
+}
+
+func transcribeAudio(ctx context.Context, client *whatsmeow.Client, policy mediaPolicy, transcriber Transcriber, audio *waProto.AudioMessage) (string, error) {
+	data, _, err := downloadMedia(ctx, client, audio, policy)
+	if err != nil {
+		return "", fmt.Errorf("download audio: %w", err)
+	}
+
+	return transcriber.Transcribe(ctx, data, audio.GetMimetype())
+}
+
+func (c *OpenAIClient) Transcribe(ctx context.Context, audio []byte, mimeType string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("model", c.transcribeModel); err != nil {
+		return "", fmt.Errorf("encode form: %w", err)
+	}
+	part, err := form.CreateFormFile("file", "audio."+audioExtension(mimeType))
+	if err != nil {
+		return "", fmt.Errorf("encode form: %w", err)
+	}
+	if _, err := part.Write(audio); err != nil {
+		return "", fmt.Errorf("encode form: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("encode form: %w", err)
+	}
+
+	var text string
+	err = c.withRetry(ctx, func() error {
+		resp, err := c.postContent(ctx, "/audio/transcriptions", form.FormDataContentType(), body.Bytes())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("read response: %w", err)
+		}
+
+		var parsed transcriptionResponse
+		if err := json.Unmarshal(respBody, &parsed); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+
+		text = strings.TrimSpace(parsed.Text)
+		if text == "" {
+			return errors.New("openai returned empty transcription")
+		}
+		return nil
+	})
+	return text, err
+}
+
+// WhatsApp voice notes are ogg/opus; Whisper picks the decoder from the file extension.
+func audioExtension(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return "ogg"
+	}
+
+	switch mediaType {
+	case "audio/mpeg":
+		return "mp3"
+	case "audio/mp4", "audio/aac", "audio/x-m4a":
+		return "m4a"
+	case "audio/wav", "audio/x-wav":
+		return "wav"
+	case "audio/webm":
+		return "webm"
+	default:
+		return "ogg"
+	}
+}
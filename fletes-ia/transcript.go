@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	directionIn  = "in"
+	directionOut = "out"
+)
+
+var transcriptHeader = []string{"timestamp", "chat_jid", "sender", "direction", "text"}
+
+// TranscriptWriter appends one CSV row per message. A nil writer discards
+// everything, so callers don't need to check whether transcripts are enabled.
+type TranscriptWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	csv  *csv.Writer
+}
+
+func NewTranscriptWriter(path string) (*TranscriptWriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat transcript: %w", err)
+	}
+
+	w := &TranscriptWriter{file: file, csv: csv.NewWriter(file)}
+	if info.Size() == 0 {
+		if err := w.writeRow(transcriptHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+func (w *TranscriptWriter) Write(at time.Time, chat, sender, direction, text string) error {
+	if w == nil {
+		return nil
+	}
+	return w.writeRow([]string{at.UTC().Format(time.RFC3339), chat, sender, direction, text})
+}
+
+func (w *TranscriptWriter) writeRow(row []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.csv.Write(row); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+	return nil
+}
+
+func (w *TranscriptWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type tokenUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"-"`
+}
+
+func (u tokenUsage) Add(other tokenUsage) tokenUsage {
+	return tokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+		CostUSD:          u.CostUSD + other.CostUSD,
+	}
+}
+
+// modelPrice is expressed in USD per 1K tokens.
+type modelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+type usageTotals struct {
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	TotalTokens      int64
+	CostUSD          float64
+}
+
+type UsageTracker struct {
+	mu     sync.Mutex
+	prices map[string]modelPrice
+	totals usageTotals
+}
+
+func NewUsageTracker(prices map[string]modelPrice) *UsageTracker {
+	return &UsageTracker{prices: prices}
+}
+
+func (t *UsageTracker) Record(model string, usage tokenUsage) float64 {
+	cost := t.Cost(model, usage)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totals.Requests++
+	t.totals.PromptTokens += int64(usage.PromptTokens)
+	t.totals.CompletionTokens += int64(usage.CompletionTokens)
+	t.totals.TotalTokens += int64(usage.TotalTokens)
+	t.totals.CostUSD += cost
+	return cost
+}
+
+func (t *UsageTracker) Totals() usageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.totals
+}
+
+// Cost matches the model exactly first and then by the longest configured
+// prefix, so dated snapshots like "gpt-4o-mini-2024-07-18" use the base price.
+func (t *UsageTracker) Cost(model string, usage tokenUsage) float64 {
+	price, ok := t.prices[model]
+	if !ok {
+		best := ""
+		for name, p := range t.prices {
+			if strings.HasPrefix(model, name) && len(name) > len(best) {
+				best, price, ok = name, p, true
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+	return float64(usage.PromptTokens)/1000*price.Prompt + float64(usage.CompletionTokens)/1000*price.Completion
+}
+
+// parsePricing reads "model=prompt/completion" pairs separated by commas,
+// e.g. "gpt-4o-mini=0.00015/0.0006".
+func parsePricing(key, value string) (map[string]modelPrice, error) {
+	prices := map[string]modelPrice{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(item, "=")
+		promptRate, completionRate, okRates := strings.Cut(rates, "/")
+		if !ok || !okRates || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("%s: invalid entry %q", key, item)
+		}
+		prompt, err := strconv.ParseFloat(strings.TrimSpace(promptRate), 64)
+		if err != nil || prompt < 0 {
+			return nil, fmt.Errorf("%s: invalid prompt price in %q", key, item)
+		}
+		completion, err := strconv.ParseFloat(strings.TrimSpace(completionRate), 64)
+		if err != nil || completion < 0 {
+			return nil, fmt.Errorf("%s: invalid completion price in %q", key, item)
+		}
+		prices[strings.TrimSpace(model)] = modelPrice{Prompt: prompt, Completion: completion}
+	}
+	return prices, nil
+}
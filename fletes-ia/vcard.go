@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+type sharedContact struct {
+	Name   string
+	Phones []string
+}
+
+// sharedContacts reads the contact cards of a ContactMessage or
+// ContactsArrayMessage. Cards without a name or phone are left out.
+func sharedContacts(msg *waProto.Message) []sharedContact {
+	var cards []*waProto.ContactMessage
+	if card := msg.GetContactMessage(); card != nil {
+		cards = append(cards, card)
+	}
+	cards = append(cards, msg.GetContactsArrayMessage().GetContacts()...)
+
+	var contacts []sharedContact
+	for _, card := range cards {
+		contact := parseVCard(card.GetVcard())
+		if name := strings.TrimSpace(card.GetDisplayName()); name != "" {
+			contact.Name = name
+		}
+		if contact.Name != "" || len(contact.Phones) > 0 {
+			contacts = append(contacts, contact)
+		}
+	}
+	return contacts
+}
+
+// parseVCard takes the name and phone numbers out of a vCard. Argentine
+// numbers are normalized to E.164; WhatsApp's waid parameter stands in for a
+// TEL line without a value.
+func parseVCard(vcard string) sharedContact {
+	var (
+		contact    sharedContact
+		structured string
+		lines      []string
+	)
+	for _, line := range strings.Split(strings.ReplaceAll(vcard, "\r\n", "\n"), "\n") {
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		params := strings.Split(key, ";")
+		property := strings.ToUpper(params[0])
+		if _, name, grouped := strings.Cut(property, "."); grouped {
+			property = name
+		}
+		value = strings.TrimSpace(value)
+
+		switch property {
+		case "FN":
+			contact.Name = unescapeVCard(value)
+		case "N":
+			parts := strings.Split(value, ";")
+			if len(parts) > 1 {
+				parts[0], parts[1] = parts[1], parts[0]
+			}
+			structured = strings.Join(strings.Fields(unescapeVCard(strings.Join(parts, " "))), " ")
+		case "TEL":
+			if value == "" {
+				for _, param := range params[1:] {
+					if waid, ok := strings.CutPrefix(strings.ToLower(param), "waid="); ok {
+						value = "+" + waid
+					}
+				}
+			}
+			if value == "" {
+				continue
+			}
+			if normalized, err := normalizeArgentinePhone(value); err == nil {
+				value = normalized
+			}
+			contact.Phones = append(contact.Phones, value)
+		}
+	}
+	if contact.Name == "" {
+		contact.Name = structured
+	}
+	return contact
+}
+
+func unescapeVCard(value string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(value)
+}
+
+// contactsText turns shared contact cards into a customer message for the
+// model, e.g. when the customer passes on the consignee's details.
+func contactsText(contacts []sharedContact) string {
+	lines := make([]string, 0, len(contacts))
+	for _, contact := range contacts {
+		name := contact.Name
+		if name == "" {
+			name = "sin nombre"
+		}
+		if len(contact.Phones) == 0 {
+			lines = append(lines, name)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s, tel. %s", name, strings.Join(contact.Phones, ", ")))
+	}
+	if len(lines) == 1 {
+		return "Te comparto un contacto: " + lines[0]
+	}
+	return fmt.Sprintf("Te comparto %d contactos:\n- %s", len(lines), strings.Join(lines, "\n- "))
+}
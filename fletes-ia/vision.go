@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/binary/proto"
+)
+
+const (
+	defaultVisionPrompt = "Si el cliente envia una foto, identifica los objetos a transportar y estima sus medidas aproximadas (alto, ancho, profundidad) y el volumen total en metros cubicos. Aclara que es una estimacion."
+	visionFallbackText  = "Te envio una foto de lo que necesito transportar."
+	imageHistoryPrefix  = "[imagen] "
+)
+
+type contentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *imageURLDetail `json:"image_url,omitempty"`
+}
+
+type imageURLDetail struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON sends multi-part content (text plus images) when Parts is set,
+// a null content for tool-call turns, and the plain string form otherwise.
+func (m chatMessage) MarshalJSON() ([]byte, error) {
+	var content any = m.Content
+	switch {
+	case len(m.Parts) > 0:
+		content = m.Parts
+	case m.Content == "" && len(m.ToolCalls) > 0:
+		content = nil
+	}
+
+	return json.Marshal(struct {
+		Role       string     `json:"role"`
+		Content    any        `json:"content"`
+		ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+		ToolCallID string     `json:"tool_call_id,omitempty"`
+	}{m.Role, content, m.ToolCalls, m.ToolCallID})
+}
+
+func (m chatMessage) hasImage() bool {
+	for _, part := range m.Parts {
+		if part.Type == "image_url" {
+			return true
+		}
+	}
+	return false
+}
+
+func imageMessage(ctx context.Context, client *whatsmeow.Client, policy mediaPolicy, image *waProto.ImageMessage, text string) (chatMessage, error) {
+	data, mimeType, err := downloadMedia(ctx, client, image, policy)
+	if err != nil {
+		return chatMessage{}, fmt.Errorf("download image: %w", err)
+	}
+	if text == "" {
+		text = visionFallbackText
+	}
+
+	return chatMessage{
+		Role:    "user",
+		Content: imageHistoryPrefix + text,
+		Parts: []contentPart{
+			{Type: "text", Text: text},
+			{Type: "image_url", ImageURL: &imageURLDetail{
+				URL: "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+			}},
+		},
+	}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookTimeout         = 10 * time.Second
+	webhookRetries         = 3
+	webhookSignatureHeader = "X-Fletes-Signature"
+)
+
+type webhookPayload struct {
+	Chat      string          `json:"chat_jid"`
+	MessageID string          `json:"message_id"`
+	Inbound   string          `json:"inbound_text"`
+	Reply     string          `json:"reply_text"`
+	Freight   *FreightRequest `json:"freight_request,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Usage     webhookUsage    `json:"usage"`
+}
+
+type webhookUsage struct {
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// WebhookNotifier posts every handled exchange to an external URL. Delivery
+// runs in the background and failures are only logged. A nil notifier does
+// nothing.
+type WebhookNotifier struct {
+	url        string
+	secret     []byte
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func NewWebhookNotifier(url, secret string, logger *slog.Logger) *WebhookNotifier {
+	if url == "" {
+		return nil
+	}
+	return &WebhookNotifier{
+		url:        url,
+		secret:     []byte(secret),
+		httpClient: &http.Client{Timeout: webhookTimeout},
+		logger:     logger.With("component", "webhook"),
+	}
+}
+
+func (w *WebhookNotifier) Notify(payload webhookPayload) {
+	if w == nil {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		w.logger.Error("marshal webhook payload failed", "error", err)
+		return
+	}
+	go w.deliver(body, payload.Chat)
+}
+
+func (w *WebhookNotifier) deliver(body []byte, chat string) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout*(webhookRetries+1))
+	defer cancel()
+
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		headers.Set(webhookSignatureHeader, "sha256="+signWebhook(w.secret, body))
+	}
+
+	err := retryWithBackoff(ctx, webhookRetries, w.logger, func() error {
+		resp, err := postHTTP(ctx, w.httpClient, "webhook", w.url, headers, body)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+	if err != nil {
+		w.logger.Warn("webhook delivery failed", "chat", chat, "error", err)
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of body, which receivers recompute
+// with the shared secret to verify the request.
+func signWebhook(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
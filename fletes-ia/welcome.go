@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const contactSchema = `
+CREATE TABLE IF NOT EXISTS fletes_contacts (
+	chat_jid      TEXT    PRIMARY KEY,
+	first_seen_at INTEGER NOT NULL
+);
+`
+
+// ContactStore remembers every chat that has written to the bot, so the
+// welcome message goes out once per contact, across restarts.
+type ContactStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// NewContactStore must run after NewConversationStore: chats that already
+// have history are recorded as known so they don't get a late welcome.
+func NewContactStore(db *sql.DB) (*ContactStore, error) {
+	if _, err := db.Exec(contactSchema); err != nil {
+		return nil, fmt.Errorf("create contacts table: %w", err)
+	}
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO fletes_contacts (chat_jid, first_seen_at)
+		SELECT chat_jid, MIN(created_at) FROM fletes_conversation_messages GROUP BY chat_jid`)
+	if err != nil {
+		return nil, fmt.Errorf("backfill contacts: %w", err)
+	}
+	return &ContactStore{db: db, now: time.Now}, nil
+}
+
+// FirstSeen records chat and reports whether this is its first message ever.
+func (s *ContactStore) FirstSeen(ctx context.Context, chat string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO fletes_contacts (chat_jid, first_seen_at) VALUES (?, ?)
+		ON CONFLICT (chat_jid) DO NOTHING`, chat, s.now().Unix())
+	if err != nil {
+		return false, fmt.Errorf("record contact: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("record contact: %w", err)
+	}
+	return n == 1, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxXLSXPartBytes = 8 << 20
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+type xlsxRichText struct {
+	Text string        `xml:"t"`
+	Runs []xlsxTextRun `xml:"r"`
+}
+
+type xlsxTextRun struct {
+	Text string `xml:"t"`
+}
+
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var b strings.Builder
+	for _, run := range t.Runs {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Type   string       `xml:"t,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// extractXLSXText renders every worksheet as tab-separated rows. Formulas are
+// reported by their cached value.
+func extractXLSXText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("open xlsx: %w", err)
+	}
+
+	var shared []string
+	var sheets []*zip.File
+	for _, file := range archive.File {
+		switch {
+		case file.Name == "xl/sharedStrings.xml":
+			var sst xlsxSharedStrings
+			if err := decodeZipXML(file, &sst); err != nil {
+				return "", err
+			}
+			for _, item := range sst.Items {
+				shared = append(shared, item.String())
+			}
+		case strings.HasPrefix(file.Name, "xl/worksheets/sheet") && strings.HasSuffix(file.Name, ".xml"):
+			sheets = append(sheets, file)
+		}
+	}
+	sort.Slice(sheets, func(i, j int) bool {
+		return sheetNumber(sheets[i].Name) < sheetNumber(sheets[j].Name)
+	})
+
+	var out strings.Builder
+	for _, file := range sheets {
+		var sheet xlsxWorksheet
+		if err := decodeZipXML(file, &sheet); err != nil {
+			return "", err
+		}
+		for _, row := range sheet.Rows {
+			cells := make([]string, 0, len(row.Cells))
+			for _, cell := range row.Cells {
+				value := cell.Value
+				switch cell.Type {
+				case "s":
+					if idx, err := strconv.Atoi(value); err == nil && idx >= 0 && idx < len(shared) {
+						value = shared[idx]
+					}
+				case "inlineStr":
+					value = cell.Inline.String()
+				}
+				cells = append(cells, strings.TrimSpace(value))
+			}
+			if line := strings.TrimRight(strings.Join(cells, "\t"), "\t"); line != "" {
+				out.WriteString(line)
+				out.WriteByte('\n')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	return out.String(), nil
+}
+
+func decodeZipXML(file *zip.File, v any) error {
+	r, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", file.Name, err)
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(io.LimitReader(r, maxXLSXPartBytes)).Decode(v); err != nil {
+		return fmt.Errorf("parse %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+func sheetNumber(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "xl/worksheets/sheet"), ".xml"))
+	return n
+}